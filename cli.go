@@ -0,0 +1,979 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ExitOK      = 0
+	ExitInvalid = 1
+	ExitUsage   = 2
+
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// Commands lists the non-interactive subcommands, keyed by name.
+var Commands = map[string]func(args []string, stdin io.Reader, stdout, stderr io.Writer) int{
+	"decode":   RunDecodeCommand,
+	"encode":   RunEncodeCommand,
+	"crack":    RunCrackCommand,
+	"fixtures": RunFixturesCommand,
+	"keygen":   RunKeygenCommand,
+}
+
+// DecodeReport is the machine readable output of the decode command.
+type DecodeReport struct {
+	Header            map[string]any    `json:"header"`
+	Claims            any               `json:"claims"`
+	Algorithm         string            `json:"algorithm,omitempty"`
+	KeyID             string            `json:"kid,omitempty"`
+	Valid             bool              `json:"valid"`
+	SignatureVerified bool              `json:"signature_verified"`
+	Issues            []JWTIssue        `json:"issues"`
+	Messages          []string          `json:"messages"`
+	KeyError          string            `json:"key_error,omitempty"`
+	Checks            []JWTCheck        `json:"checks,omitempty"`
+	Encryption        string            `json:"encryption,omitempty"`
+	Decrypted         bool              `json:"decrypted,omitempty"`
+	Payload           string            `json:"payload,omitempty"`
+	NestedTokens      []NestedToken     `json:"nested_tokens,omitempty"`
+	SchemaViolations  []SchemaViolation `json:"schema_violations,omitempty"`
+
+	// SignatureAlgorithm and SignatureKeyID describe the signed token nested
+	// in a JWE.
+	SignatureAlgorithm string `json:"signature_algorithm,omitempty"`
+	SignatureKeyID     string `json:"signature_kid,omitempty"`
+}
+
+// RunDecodeCommand implements `jwtx decode [token]`.
+func RunDecodeCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("decode", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: jwtx decode [flags] [token]")
+		fmt.Fprintln(stderr, "\nDecodes a JWT given as an argument or on stdin and verifies it when a key is given.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+
+	secret := flags.String("secret", "", "HMAC secret or PEM encoded key used to verify the signature")
+	keyFile := flags.String("key-file", "", "file holding the secret or PEM encoded key")
+	passphrase := flags.String("passphrase", "", "passphrase of an encrypted private key decrypting a JWE")
+	jwksFile := flags.String("jwks", "", "file holding a JWK or JWK Set used to verify the signature")
+	jwksURL := flags.String("jwks-url", "", "URL of a JWK Set used to verify the signature")
+	oidcIssuer := flags.String("oidc-issuer", "", "OpenID Connect issuer whose discovery document supplies the keys, iss and allowed algorithms")
+	audience := flags.String("audience", "", "require aud to contain this value (default --client-id for ID tokens)")
+	idToken := addIDTokenFlags(flags)
+	policy := addPolicyFlags(flags, stdin)
+	schemaFile := flags.String("schema", "", "file holding a JSON Schema the {\"header\": ..., \"claims\": ...} of the token must match")
+	rulesFile := flags.String("rules", "", "file holding CEL rules over header and claims that must all be true")
+	timeZone := flags.String("tz", "Local", "time zone of the timestamps shown next to time claims, e.g. UTC or Europe/Berlin")
+	at := flags.String("at", "", "evaluate time claims at this instant instead of now (RFC 3339, YYYY-MM-DD HH:MM:SS in --tz, or Unix seconds)")
+	leeway := flags.String("leeway", "", "clock skew allowed when validating time claims, e.g. 30s or 2m")
+	output := flags.String("output", OutputText, "output format: text or json")
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	if *output != OutputText && *output != OutputJSON {
+		fmt.Fprintf(stderr, "jwtx: unknown output format %q\n", *output)
+		return ExitUsage
+	}
+
+	if flags.Lookup("policy").Value.String() == "-" && flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "jwtx: --policy and the token cannot both read stdin")
+		return ExitUsage
+	}
+
+	loc, err := time.LoadLocation(*timeZone)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: unknown time zone %q\n", *timeZone)
+		return ExitUsage
+	}
+
+	evaluateAt, err := ParseEvaluationTime(*at, loc)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: --at: %v\n", err)
+		return ExitUsage
+	}
+
+	skew, err := ParseLeeway(*leeway)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: --leeway: %v\n", err)
+		return ExitUsage
+	}
+
+	validationPolicy, err := policy()
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: --policy: %v\n", err)
+		return ExitUsage
+	}
+
+	schema, err := readTokenSchema(*schemaFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: --schema: %v\n", err)
+		return ExitUsage
+	}
+
+	rules, err := readRules(*rulesFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: --rules: %v\n", err)
+		return ExitUsage
+	}
+
+	token, err := readTokenArg(flags.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: %v\n", err)
+		return ExitUsage
+	}
+
+	key, err := readKeyFlags(*secret, *keyFile, *jwksFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: %v\n", err)
+		return ExitUsage
+	}
+
+	// A JWE is decrypted with the key flags and its nested token verified
+	// with the remote key set.
+	encrypted := IsJWECompact(token)
+
+	if *jwksURL != "" && key != "" && !encrypted {
+		fmt.Fprintln(stderr, "jwtx: --jwks-url cannot be combined with another key flag")
+		return ExitUsage
+	}
+
+	if *jwksURL != "" && *oidcIssuer != "" {
+		fmt.Fprintln(stderr, "jwtx: --jwks-url cannot be combined with --oidc-issuer")
+		return ExitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	options := JWTDecodeOptions{Secret: key, Passphrase: *passphrase, Audience: *audience, IDToken: idToken(), At: evaluateAt, Leeway: skew, Policy: validationPolicy, Schema: schema, Rules: rules}
+
+	var remoteJWKS *RemoteJWKS
+	if *jwksURL != "" {
+		remoteJWKS = NewRemoteJWKS(*jwksURL, nil)
+	}
+
+	if *oidcIssuer != "" {
+		provider, err := DiscoverOIDCProvider(ctx, *oidcIssuer, nil)
+		if err != nil {
+			fmt.Fprintf(stderr, "jwtx: %v\n", err)
+			return ExitInvalid
+		}
+
+		options = provider.DecodeOptions(options)
+		if key == "" || encrypted {
+			remoteJWKS = provider.JWKS
+		}
+	}
+
+	if remoteJWKS != nil {
+		options.KeySet, err = remoteJWKS.KeySet(ctx, TokenKeyID(token))
+		if err != nil {
+			fmt.Fprintf(stderr, "jwtx: %v\n", err)
+			return ExitInvalid
+		}
+	}
+
+	result := JWTDecodeToken(token, options)
+	report := NewDecodeReport(result, key != "" || options.KeySet != nil)
+
+	switch *output {
+	case OutputJSON:
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintf(stderr, "jwtx: %v\n", err)
+			return ExitUsage
+		}
+	default:
+		writeDecodeText(stdout, result, report, loc, options.Now())
+	}
+
+	if errors.Is(result.KeyError, ErrPassphraseRequired) {
+		fmt.Fprintf(stderr, "jwtx: %s, pass it with --passphrase\n", ErrPassphraseRequired)
+	}
+
+	if !report.Valid {
+		return ExitInvalid
+	}
+
+	return ExitOK
+}
+
+// RunEncodeCommand implements `jwtx encode`, printing the compact token.
+func RunEncodeCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("encode", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: jwtx encode [flags]")
+		fmt.Fprintln(stderr, "\nSigns a JWT from header and claims JSON files and prints the compact token.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+
+	var claimFlags stringsFlag
+
+	headerFile := flags.String("header", "", "file holding the header JSON, - reads stdin (default {\"alg\":\"HS256\",\"typ\":\"JWT\"})")
+	claimsFile := flags.String("claims", "", "file holding the claims JSON, - reads stdin")
+	alg := flags.String("alg", "", "signing algorithm, overrides the header alg")
+	secret := flags.String("secret", "", "HMAC secret used to sign the token")
+	keyFile := flags.String("key", "", "file holding the secret or PEM encoded private key")
+	passphrase := flags.String("passphrase", "", "passphrase of an encrypted private key")
+	exp := flags.Duration("exp", 0, "set exp to now plus the duration, e.g. 15m")
+	iat := flags.Bool("iat", false, "set iat to now")
+	schemaFile := flags.String("schema", "", "file holding a JSON Schema the {\"header\": ..., \"claims\": ...} of the token must match before it is signed")
+	flags.Var(&claimFlags, "claim", "set a claim as key=value, the value is parsed as JSON when possible (repeatable)")
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	if flags.NArg() > 0 {
+		fmt.Fprintf(stderr, "jwtx: unexpected argument %q\n", flags.Arg(0))
+		return ExitUsage
+	}
+
+	if *headerFile == "-" && *claimsFile == "-" {
+		fmt.Fprintln(stderr, "jwtx: --header and --claims cannot both read stdin")
+		return ExitUsage
+	}
+
+	key, err := readKeyFlags(*secret, *keyFile, "")
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: %v\n", err)
+		return ExitUsage
+	}
+
+	schema, err := readTokenSchema(*schemaFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: --schema: %v\n", err)
+		return ExitUsage
+	}
+
+	header := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	if *headerFile != "" {
+		if header, err = readJSONObject(*headerFile, stdin); err != nil {
+			fmt.Fprintf(stderr, "jwtx: Invalid header JSON: %v\n", err)
+			return ExitInvalid
+		}
+	}
+
+	if *alg != "" {
+		header["alg"] = *alg
+	}
+
+	claims := jwt.MapClaims{}
+	if *claimsFile != "" {
+		if claims, err = readJSONObject(*claimsFile, stdin); err != nil {
+			fmt.Fprintf(stderr, "jwtx: Invalid payload JSON: %v\n", err)
+			return ExitInvalid
+		}
+	}
+
+	for _, claim := range claimFlags {
+		name, value, ok := strings.Cut(claim, "=")
+		if !ok || name == "" {
+			fmt.Fprintf(stderr, "jwtx: invalid --claim %q, expected key=value\n", claim)
+			return ExitUsage
+		}
+		claims[name] = parseClaimValue(value)
+	}
+
+	now := time.Now()
+	if *iat {
+		claims["iat"] = now.Unix()
+	}
+	if *exp != 0 {
+		claims["exp"] = now.Add(*exp).Unix()
+	}
+
+	if schema != nil {
+		if violations := schema.Validate(header, claims); len(violations) > 0 {
+			for _, violation := range violations {
+				fmt.Fprintf(stderr, "jwtx: %s\n", violation)
+			}
+			return ExitInvalid
+		}
+	}
+
+	result := JWTEncodeToken(header, claims, key, *passphrase)
+	if errors.Is(result.SigningErr, ErrPassphraseRequired) {
+		fmt.Fprintf(stderr, "jwtx: %s, pass it with --passphrase\n", ErrPassphraseRequired)
+		return ExitInvalid
+	}
+	for _, message := range []string{result.HeaderError, result.PayloadError, result.SigningError} {
+		if message != "" {
+			fmt.Fprintf(stderr, "jwtx: %s\n", message)
+			return ExitInvalid
+		}
+	}
+
+	fmt.Fprintln(stdout, result.Token)
+
+	return ExitOK
+}
+
+// RunCrackCommand implements `jwtx crack --wordlist words.txt [token]`,
+// auditing the HMAC secret of a token against a wordlist. It exits with
+// ExitInvalid when the secret is found.
+func RunCrackCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("crack", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: jwtx crack --wordlist words.txt [flags] [token]")
+		fmt.Fprintln(stderr, "\nTries every line of the wordlist as the secret of an HS256, HS384 or HS512 token.")
+		fmt.Fprintln(stderr, "Exits with status 1 when the secret is found.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+
+	wordlistFile := flags.String("wordlist", "", "file holding one candidate secret per line")
+	workers := flags.Int("workers", runtime.NumCPU(), "number of candidates tried in parallel")
+	output := flags.String("output", OutputText, "output format: text or json")
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	if *output != OutputText && *output != OutputJSON {
+		fmt.Fprintf(stderr, "jwtx: unknown output format %q\n", *output)
+		return ExitUsage
+	}
+
+	if *wordlistFile == "" {
+		fmt.Fprintln(stderr, "jwtx: --wordlist is required")
+		return ExitUsage
+	}
+
+	token, err := readTokenArg(flags.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: %v\n", err)
+		return ExitUsage
+	}
+
+	wordlist, err := os.Open(*wordlistFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: %v\n", err)
+		return ExitUsage
+	}
+	defer wordlist.Close()
+
+	var size int64
+	if info, err := wordlist.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var counter CrackCounter
+	done, reported := make(chan struct{}), make(chan struct{})
+	if f, ok := stderr.(*os.File); ok && isTerminal(f) {
+		go func() {
+			reportCrackProgress(stderr, &counter, size, done)
+			close(reported)
+		}()
+	} else {
+		close(reported)
+	}
+
+	result, err := CrackHMACSecret(ctx, token, wordlist, *workers, &counter)
+	close(done)
+	<-reported
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: %v\n", err)
+		return ExitUsage
+	}
+
+	switch *output {
+	case OutputJSON:
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			fmt.Fprintf(stderr, "jwtx: %v\n", err)
+			return ExitUsage
+		}
+	default:
+		if result.Found {
+			fmt.Fprintf(stdout, "Secret found: %s\n", result.Secret)
+		} else {
+			fmt.Fprintf(stdout, "Secret not found in %d candidates\n", result.Tried)
+		}
+	}
+
+	if result.Found {
+		return ExitInvalid
+	}
+
+	return ExitOK
+}
+
+// reportCrackProgress redraws a progress line on the terminal until done is
+// closed.
+func reportCrackProgress(w io.Writer, counter *CrackCounter, size int64, done <-chan struct{}) {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			fmt.Fprint(w, "\r\033[K")
+			return
+		case <-ticker.C:
+			fmt.Fprintf(w, "\r\033[K%s", FormatCrackProgress(counter, size))
+		}
+	}
+}
+
+// RunFixturesCommand implements `jwtx fixtures [token]`.
+func RunFixturesCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fixtures", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: jwtx fixtures [--key-file public.pem] [flags] [token]")
+		fmt.Fprintln(stderr, "\nDerives labelled attack tokens from a legitimately signed token, for testing your own verifiers:")
+		fmt.Fprintln(stderr, "alg none, a stripped signature, an embedded jwk and, given the public key, HMAC key confusion.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+
+	keyFile := flags.String("key-file", "", "file holding the token's public key as PEM, a JWK or a JWK Set")
+	output := flags.String("output", OutputText, "output format: text or json")
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	if *output != OutputText && *output != OutputJSON {
+		fmt.Fprintf(stderr, "jwtx: unknown output format %q\n", *output)
+		return ExitUsage
+	}
+
+	token, err := readTokenArg(flags.Args(), stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: %v\n", err)
+		return ExitUsage
+	}
+
+	publicKey, err := readKeyFlags("", *keyFile, "")
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: %v\n", err)
+		return ExitUsage
+	}
+
+	attackerKey, err := GenerateAttackerKey()
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: %v\n", err)
+		return ExitInvalid
+	}
+
+	fixtures, err := GenerateAttackFixtures(token, publicKey, attackerKey)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: %v\n", err)
+		return ExitInvalid
+	}
+
+	switch *output {
+	case OutputJSON:
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(fixtures); err != nil {
+			fmt.Fprintf(stderr, "jwtx: %v\n", err)
+			return ExitUsage
+		}
+	default:
+		fmt.Fprintln(stdout, FormatAttackFixtures(fixtures))
+	}
+
+	return ExitOK
+}
+
+// RunKeygenCommand implements `jwtx keygen`.
+func RunKeygenCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: jwtx keygen [--type RSA-2048] [flags]")
+		fmt.Fprintln(stderr, "\nGenerates an HMAC secret or a key pair, printing the private and public PEM, or the secret.")
+		fmt.Fprintln(stderr, "JSON output adds the private JWK and a JWK Set, keyed by their RFC 7638 thumbprint.")
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+
+	kinds := make([]string, 0, len(KeyKinds))
+	for _, kind := range KeyKinds {
+		kinds = append(kinds, string(kind))
+	}
+
+	kindName := flags.String("type", string(DefaultKeyKind), "key type: "+strings.Join(kinds, ", "))
+	length := flags.Int("length", DefaultHMACLength, "length of an HMAC secret in characters")
+	alg := flags.String("alg", "", "algorithm set in the JWKs (default RS256 for RSA, the strongest HS* the length allows for HMAC)")
+	output := flags.String("output", OutputText, "output format: text or json")
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	if *output != OutputText && *output != OutputJSON {
+		fmt.Fprintf(stderr, "jwtx: unknown output format %q\n", *output)
+		return ExitUsage
+	}
+
+	if flags.NArg() > 0 {
+		fmt.Fprintln(stderr, "jwtx: keygen takes no arguments")
+		return ExitUsage
+	}
+
+	kind, err := ParseKeyKind(*kindName)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: %v\n", err)
+		return ExitUsage
+	}
+
+	if *alg != "" {
+		if err := CheckKeyAlgorithm(kind, *length, *alg); err != nil {
+			fmt.Fprintf(stderr, "jwtx: %v\n", err)
+			return ExitUsage
+		}
+	}
+
+	key, err := GenerateKey(kind, *length)
+	if err == nil && *alg != "" {
+		key, err = key.WithAlgorithm(*alg)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: %v\n", err)
+		return ExitUsage
+	}
+
+	switch *output {
+	case OutputJSON:
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(key); err != nil {
+			fmt.Fprintf(stderr, "jwtx: %v\n", err)
+			return ExitUsage
+		}
+	default:
+		if kind == KeyKindHMAC {
+			fmt.Fprintln(stdout, key.Secret)
+		} else {
+			fmt.Fprint(stdout, key.PrivatePEM, key.PublicPEM)
+		}
+	}
+
+	return ExitOK
+}
+
+// NewDecodeReport summarises a decode result. Without a key the signature
+// cannot be checked, which is reported but does not make the token invalid.
+func NewDecodeReport(result *JWTDecodeResult, keySupplied bool) DecodeReport {
+	report := DecodeReport{
+		Algorithm:         result.Algorithm,
+		KeyID:             result.KeyID,
+		SignatureVerified: result.IsSignatureValid(),
+		Issues:            []JWTIssue{},
+		Messages:          []string{},
+		Checks:            result.Checks,
+		Encryption:        result.Encryption,
+		Decrypted:         result.IsDecrypted(),
+		NestedTokens:      FindNestedTokens(result),
+		SchemaViolations:  result.SchemaViolations,
+	}
+
+	if result.Token != nil {
+		report.Header = result.Token.Header
+		report.Claims = result.Token.Claims
+	}
+
+	// A JWE may carry a payload that is not a JSON claims set.
+	if report.Decrypted && result.Token.Claims == nil {
+		report.Payload = string(result.Plaintext)
+	}
+
+	if result.Signed != nil {
+		report.SignatureAlgorithm = result.Signed.Algorithm
+		report.SignatureKeyID = result.Signed.KeyID
+	}
+
+	if result.KeyError != nil && keySupplied {
+		report.KeyError = result.KeyError.Error()
+	}
+
+	for _, issue := range result.Issues {
+		if issue == IssueUnverifiable && !keySupplied {
+			continue
+		}
+		report.Issues = append(report.Issues, issue)
+		report.Messages = append(report.Messages, IssueStatuses[issue])
+	}
+
+	report.Valid = len(report.Issues) == 0
+
+	return report
+}
+
+func writeDecodeText(w io.Writer, result *JWTDecodeResult, report DecodeReport, loc *time.Location, now time.Time) {
+	if result.Token != nil {
+		fmt.Fprintf(w, "Header:\n%s\n\n", result.JsonMarshaledHeader())
+	}
+
+	switch {
+	case result.Token != nil && result.Token.Claims != nil:
+		fmt.Fprintf(w, "Claims:\n%s\n\n", AnnotateTimeClaims(result.JsonMarshaledClaims(), now, loc))
+	case len(result.Plaintext) > 0:
+		fmt.Fprintf(w, "Payload:\n%s\n\n", result.Plaintext)
+	}
+
+	if report.Algorithm != "" {
+		fmt.Fprintf(w, "Algorithm: %s\n", report.Algorithm)
+	}
+
+	if result.Encrypted {
+		writeDecryptionText(w, result, report)
+		if report.Decrypted {
+			writeNestedSignatureText(w, result, report)
+		}
+	} else {
+		writeSignatureText(w, result, report)
+	}
+
+	if len(report.Checks) > 0 {
+		fmt.Fprintf(w, "\nChecks:\n%s\n\n", FormatChecks(report.Checks))
+	}
+
+	if len(report.SchemaViolations) > 0 {
+		fmt.Fprintf(w, "\nSchema violations:\n")
+		for _, violation := range report.SchemaViolations {
+			fmt.Fprintf(w, "  %s\n", violation)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if len(report.NestedTokens) > 0 {
+		fmt.Fprintf(w, "\nNested tokens:\n")
+		for _, nested := range report.NestedTokens {
+			fmt.Fprintf(w, "  %s\n", nested.Path)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if report.Valid {
+		fmt.Fprintf(w, "Status: %s\n", StatusValidJWT)
+	} else {
+		fmt.Fprintf(w, "Status: %s\n", strings.Join(report.Messages, ", "))
+	}
+}
+
+func writeSignatureText(w io.Writer, result *JWTDecodeResult, report DecodeReport) {
+	switch {
+	case report.SignatureVerified && report.KeyID != "":
+		fmt.Fprintf(w, "Signature: %s (kid %s)\n", StatusSignatureVerified, report.KeyID)
+	case report.SignatureVerified:
+		fmt.Fprintf(w, "Signature: %s\n", StatusSignatureVerified)
+	case report.KeyError != "":
+		fmt.Fprintf(w, "Signature: %s\n", report.KeyError)
+	case result.Has(IssueSignatureInvalid):
+		fmt.Fprintf(w, "Signature: %s\n", StatusSignatureVerificationFailed)
+	default:
+		fmt.Fprintf(w, "Signature: %s\n", StatusSignatureUnverifiable)
+	}
+}
+
+// writeNestedSignatureText reports the signature of the token nested in a
+// decrypted JWE, which is what authenticates it unless the key is shared.
+func writeNestedSignatureText(w io.Writer, result *JWTDecodeResult, report DecodeReport) {
+	signed := result.Signed
+	if signed == nil && report.SignatureVerified {
+		fmt.Fprintf(w, "Signature: %s\n", StatusSharedKey)
+		return
+	}
+	if signed == nil {
+		fmt.Fprintf(w, "Signature: %s\n", StatusUnsigned)
+		return
+	}
+
+	fmt.Fprintf(w, "Signature algorithm: %s\n", report.SignatureAlgorithm)
+
+	switch {
+	case report.SignatureVerified && report.SignatureKeyID != "":
+		fmt.Fprintf(w, "Signature: %s (kid %s)\n", StatusSignatureVerified, report.SignatureKeyID)
+	case report.SignatureVerified:
+		fmt.Fprintf(w, "Signature: %s\n", StatusSignatureVerified)
+	case signed.KeyError != nil:
+		fmt.Fprintf(w, "Signature: %s\n", signed.KeyError)
+	case signed.Has(IssueSignatureInvalid):
+		fmt.Fprintf(w, "Signature: %s\n", StatusSignatureVerificationFailed)
+	default:
+		fmt.Fprintf(w, "Signature: %s\n", StatusSignatureUnverifiable)
+	}
+}
+
+func writeDecryptionText(w io.Writer, result *JWTDecodeResult, report DecodeReport) {
+	fmt.Fprintf(w, "Encryption: %s\n", report.Encryption)
+
+	switch {
+	case report.Decrypted && report.KeyID != "":
+		fmt.Fprintf(w, "Decryption: %s (kid %s)\n", StatusDecrypted, report.KeyID)
+	case report.Decrypted:
+		fmt.Fprintf(w, "Decryption: %s\n", StatusDecrypted)
+	case report.KeyError != "":
+		fmt.Fprintf(w, "Decryption: %s\n", report.KeyError)
+	case result.Has(IssueDecryptionFailed):
+		fmt.Fprintf(w, "Decryption: %s\n", StatusDecryptionFailed)
+	default:
+		fmt.Fprintf(w, "Decryption: %s\n", StatusUndecryptable)
+	}
+}
+
+// addIDTokenFlags registers the OpenID Connect ID token validation flags.
+// The returned function gives the expectations once flags are parsed, or nil
+// when none of them was set.
+func addIDTokenFlags(flags *flag.FlagSet) func() *IDTokenExpectations {
+	var expected IDTokenExpectations
+
+	flags.StringVar(&expected.ClientID, "client-id", "", "validate as an ID token issued to this client_id (aud, azp)")
+	flags.StringVar(&expected.Nonce, "nonce", "", "validate as an ID token carrying this nonce")
+	flags.StringVar(&expected.AccessToken, "access-token", "", "validate the ID token at_hash against this access token")
+	flags.StringVar(&expected.AuthorizationCode, "code", "", "validate the ID token c_hash against this authorization code")
+	flags.DurationVar(&expected.MaxAge, "max-age", 0, "validate the ID token auth_time against this max_age, e.g. 1h")
+
+	return func() *IDTokenExpectations {
+		if expected == (IDTokenExpectations{}) {
+			return nil
+		}
+		return &expected
+	}
+}
+
+// addPolicyFlags registers the validation policy flags. The returned function
+// gives the policy read from --policy with the other flags added to it, or nil
+// when none of them was set.
+func addPolicyFlags(flags *flag.FlagSet, stdin io.Reader) func() (*ValidationPolicy, error) {
+	var issuers, audiences, subjects, requiredClaims, allowedAlgorithms stringsFlag
+
+	policyFile := flags.String("policy", "", "file holding a validation policy JSON, - reads stdin")
+	flags.Var(&issuers, "expect-iss", "require iss to be this value (repeatable, any one matches)")
+	flags.Var(&audiences, "expect-aud", "require aud to include this value (repeatable, any one matches)")
+	flags.Var(&subjects, "expect-sub", "require sub to be this value (repeatable, any one matches)")
+	flags.Var(&requiredClaims, "require-claim", "require this claim to be present (repeatable)")
+	flags.Var(&allowedAlgorithms, "allowed-alg", "require alg to be this algorithm (repeatable, any one matches)")
+	maxLifetime := flags.Duration("max-lifetime", 0, "require exp - iat to be at most this duration, e.g. 1h")
+
+	return func() (*ValidationPolicy, error) {
+		var policy ValidationPolicy
+		if *policyFile != "" {
+			var data []byte
+			var err error
+			if *policyFile == "-" {
+				data, err = io.ReadAll(stdin)
+			} else {
+				data, err = os.ReadFile(*policyFile)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			parsed, err := ParsePolicy(data)
+			if err != nil {
+				return nil, err
+			}
+			policy = *parsed
+		}
+
+		policy.Issuers = append(policy.Issuers, issuers...)
+		policy.Audiences = append(policy.Audiences, audiences...)
+		policy.Subjects = append(policy.Subjects, subjects...)
+		policy.RequiredClaims = append(policy.RequiredClaims, requiredClaims...)
+		policy.AllowedAlgorithms = append(policy.AllowedAlgorithms, allowedAlgorithms...)
+		if *maxLifetime > 0 {
+			policy.MaxLifetime = PolicyDuration(*maxLifetime)
+		}
+
+		if policy.IsZero() {
+			return nil, nil
+		}
+		return &policy, nil
+	}
+}
+
+// readTokenArg returns the token passed as the only argument, or read from
+// stdin when no argument is given.
+func readTokenArg(args []string, stdin io.Reader) (string, error) {
+	switch len(args) {
+	case 0:
+		if f, ok := stdin.(*os.File); ok && isTerminal(f) {
+			return "", errors.New("no token given, pass it as an argument or on stdin")
+		}
+
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return "", fmt.Errorf("reading token from stdin: %w", err)
+		}
+
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", errors.New("no token given, pass it as an argument or on stdin")
+		}
+		return token, nil
+	case 1:
+		return strings.TrimSpace(args[0]), nil
+	default:
+		return "", errors.New("expected a single token argument")
+	}
+}
+
+// readKeyFlags returns the verification key from --secret, --key-file or
+// --jwks, only one of which may be given.
+func readKeyFlags(secret, keyFile, jwksFile string) (string, error) {
+	given := 0
+	for _, v := range []string{secret, keyFile, jwksFile} {
+		if v != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return "", errors.New("only one of --secret, --key-file and --jwks can be used")
+	}
+
+	if keyFile == "" {
+		keyFile = jwksFile
+	}
+
+	if keyFile == "" {
+		return secret, nil
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+
+	// Editors add a trailing newline which would otherwise end up in HMAC secrets.
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// readTokenSchema compiles the JSON Schema held in path, or returns nil when
+// no path is given.
+func readTokenSchema(path string) (*TokenSchema, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTokenSchema(data)
+}
+
+// readRules compiles the CEL rules held in path, or returns nil when no path
+// is given.
+func readRules(path string) (*RuleSet, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseRules(data)
+}
+
+// readJSONFile decodes the JSON held in path, reading stdin for "-".
+func readJSONFile(path string, stdin io.Reader, v any) error {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// readJSONObject reads a JSON object like readJSONFile, rejecting null which
+// would leave the map nil.
+func readJSONObject(path string, stdin io.Reader) (map[string]any, error) {
+	var object map[string]any
+	if err := readJSONFile(path, stdin, &object); err != nil {
+		return nil, err
+	}
+
+	if object == nil {
+		return nil, errors.New("expected a JSON object, got null")
+	}
+
+	return object, nil
+}
+
+// parseClaimValue parses a --claim value as JSON, falling back to a plain
+// string so `--claim sub=alice` works without quoting.
+func parseClaimValue(value string) any {
+	var v any
+	if err := json.Unmarshal([]byte(value), &v); err == nil {
+		return v
+	}
+	return value
+}
+
+// stringsFlag collects every value of a repeatable flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// isTerminal reports whether the file is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunEncodeCommandJSONObjects(t *testing.T) {
+	encryptedKey, err := os.ReadFile("testdata/pkcs8/aes256.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		code   int
+		stderr string
+		typ    string
+	}{
+		{
+			name: "claims object",
+			args: []string{"--claims", writeTestFile(t, "claims.json", `{"sub":"alice"}`), "--claim", "admin=true"},
+			code: ExitOK,
+		},
+		{
+			name:   "null header with alg",
+			args:   []string{"--header", writeTestFile(t, "header.json", "null"), "--alg", "HS384"},
+			code:   ExitInvalid,
+			stderr: "Invalid header JSON: expected a JSON object, got null",
+		},
+		{
+			name:   "null claims with claim",
+			args:   []string{"--claims", "-", "--claim", "sub=alice", "--iat", "--exp", "1m"},
+			stdin:  "null",
+			code:   ExitInvalid,
+			stderr: "Invalid payload JSON: expected a JSON object, got null",
+		},
+		{
+			name:   "array claims",
+			args:   []string{"--claims", "-"},
+			stdin:  `["sub"]`,
+			code:   ExitInvalid,
+			stderr: "Invalid payload JSON",
+		},
+		{
+			name:   "unknown alg",
+			args:   []string{"--alg", "HS265"},
+			code:   ExitInvalid,
+			stderr: "Unsupported alg HS265",
+		},
+		{
+			name:   "alg none",
+			args:   []string{"--alg", "none"},
+			code:   ExitInvalid,
+			stderr: "Unsupported alg none",
+		},
+		{
+			name: "typ from header",
+			args: []string{"--header", writeTestFile(t, "typ.json", `{"alg":"HS256","typ":"at+jwt"}`)},
+			code: ExitOK,
+			typ:  "at+jwt",
+		},
+		{
+			name:   "encrypted key without a passphrase",
+			args:   []string{"--alg", "ES256", "--secret", string(encryptedKey)},
+			code:   ExitInvalid,
+			stderr: "private key is encrypted and needs a passphrase, pass it with --passphrase",
+		},
+		{
+			name:   "header and claims from stdin",
+			args:   []string{"--header", "-", "--claims", "-"},
+			stdin:  `{}`,
+			code:   ExitUsage,
+			stderr: "--header and --claims cannot both read stdin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"--secret", "my-secret"}, tt.args...)
+
+			code := RunEncodeCommand(args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if code != tt.code {
+				t.Fatalf("exit code = %d, want %d (stderr %q)", code, tt.code, stderr.String())
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.stderr)
+			}
+
+			if tt.code != ExitOK {
+				return
+			}
+			result := JWTDecodeToken(strings.TrimSpace(stdout.String()), JWTDecodeOptions{Secret: "my-secret"})
+			if !result.Valid() {
+				t.Errorf("encoded token is not valid: %v", result.Issues)
+			}
+			if tt.typ == "" {
+				tt.typ = "JWT"
+			}
+			if typ := result.Token.Header["typ"]; typ != tt.typ {
+				t.Errorf("typ = %v, want %s", typ, tt.typ)
+			}
+		})
+	}
+}
+
+func TestRunDecodeCommand(t *testing.T) {
+	// exp 2024-05-01 12:00:00 UTC
+	token := signTestToken(t, jwt.MapClaims{"sub": "alice", "exp": int64(1714564800)}, "my-secret")
+	before, after := "2024-05-01T11:00:00Z", "2024-05-01T12:00:20Z"
+	jwe := encryptToPKCS8Fixture(t)
+
+	tests := []struct {
+		name   string
+		args   []string
+		stdin  string
+		code   int
+		stdout string
+		stderr string
+	}{
+		{
+			name:   "valid",
+			args:   []string{"--secret", "my-secret", "--at", before, token},
+			code:   ExitOK,
+			stdout: "Status: " + StatusValidJWT,
+		},
+		{
+			name:  "token on stdin",
+			args:  []string{"--secret", "my-secret", "--at", before},
+			stdin: token + "\n",
+			code:  ExitOK,
+		},
+		{
+			name:   "wrong secret",
+			args:   []string{"--secret", "other-secret", "--at", before, token},
+			code:   ExitInvalid,
+			stdout: StatusSignatureVerificationFailed,
+		},
+		{
+			name: "expired",
+			args: []string{"--secret", "my-secret", "--at", after, token},
+			code: ExitInvalid,
+		},
+		{
+			name: "expired within leeway",
+			args: []string{"--secret", "my-secret", "--at", after, "--leeway", "30s", token},
+			code: ExitOK,
+		},
+		{
+			name:   "no key",
+			args:   []string{"--at", before, token},
+			code:   ExitOK,
+			stdout: StatusSignatureUnverifiable,
+		},
+		{
+			name:   "encrypted key",
+			args:   []string{"--key-file", "testdata/pkcs8/aes256.pem", "--passphrase", testPassphrase, jwe},
+			code:   ExitInvalid,
+			stdout: "Decryption: " + StatusDecrypted,
+		},
+		{
+			name:   "encrypted key without a passphrase",
+			args:   []string{"--key-file", "testdata/pkcs8/aes256.pem", jwe},
+			code:   ExitInvalid,
+			stderr: "pass it with --passphrase",
+		},
+		{
+			name:   "invalid at",
+			args:   []string{"--at", "tomorrow", token},
+			code:   ExitUsage,
+			stderr: "--at:",
+		},
+		{
+			name:   "invalid leeway",
+			args:   []string{"--leeway", "-5s", token},
+			code:   ExitUsage,
+			stderr: "--leeway:",
+		},
+		{
+			name:   "policy and token from stdin",
+			args:   []string{"--policy", "-"},
+			stdin:  token,
+			code:   ExitUsage,
+			stderr: "--policy and the token cannot both read stdin",
+		},
+		{
+			name:  "policy from stdin",
+			args:  []string{"--secret", "my-secret", "--at", before, "--policy", "-", token},
+			stdin: `{"issuers": ["https://issuer.example"]}`,
+			code:  ExitInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			code := RunDecodeCommand(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if code != tt.code {
+				t.Fatalf("exit code = %d, want %d (stderr %q)", code, tt.code, stderr.String())
+			}
+			if !strings.Contains(stdout.String(), tt.stdout) {
+				t.Errorf("stdout = %q, want it to contain %q", stdout.String(), tt.stdout)
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.stderr)
+			}
+		})
+	}
+}
+
+func TestRunDecodeCommandJSON(t *testing.T) {
+	token := signTestToken(t, jwt.MapClaims{"sub": "alice", "exp": int64(1714564800)}, "my-secret")
+
+	tests := []struct {
+		name     string
+		at       string
+		code     int
+		valid    bool
+		verified bool
+		issues   []JWTIssue
+	}{
+		{"valid", "2024-05-01T11:00:00Z", ExitOK, true, true, []JWTIssue{}},
+		{"expired", "2024-05-01T13:00:00Z", ExitInvalid, false, true, []JWTIssue{IssueExpired}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := []string{"--secret", "my-secret", "--at", tt.at, "--output", "json", token}
+
+			code := RunDecodeCommand(args, strings.NewReader(""), &stdout, &stderr)
+			if code != tt.code {
+				t.Fatalf("exit code = %d, want %d (stderr %q)", code, tt.code, stderr.String())
+			}
+
+			var report DecodeReport
+			if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+				t.Fatalf("decoding report %q: %v", stdout.String(), err)
+			}
+			if report.Valid != tt.valid || report.SignatureVerified != tt.verified {
+				t.Errorf("valid = %v, signature_verified = %v, want %v and %v", report.Valid, report.SignatureVerified, tt.valid, tt.verified)
+			}
+			if report.Algorithm != "HS256" {
+				t.Errorf("algorithm = %q, want HS256", report.Algorithm)
+			}
+			if !slices.Equal(report.Issues, tt.issues) {
+				t.Errorf("issues = %v, want %v", report.Issues, tt.issues)
+			}
+			if claims, _ := report.Claims.(map[string]any); claims["sub"] != "alice" {
+				t.Errorf("claims = %v, want sub alice", report.Claims)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// crackBatchSize is how many candidates a worker takes at a time.
+const crackBatchSize = 1024
+
+// CrackResult is the outcome of trying a wordlist against a token.
+type CrackResult struct {
+	Algorithm string `json:"algorithm"`
+	Found     bool   `json:"found"`
+	Secret    string `json:"secret,omitempty"`
+	Tried     int64  `json:"tried"`
+}
+
+// CrackCounter reports the progress of a running crack. Both values are
+// updated concurrently and can be read at any time.
+type CrackCounter struct {
+	Tried     atomic.Int64
+	BytesRead atomic.Int64
+}
+
+// CrackHMACSecret tries every line of the wordlist as the HMAC secret of an
+// HS256, HS384 or HS512 token, spread over the given number of workers. It
+// verifies candidates the same way JWTDecodeToken does, through the
+// token's signing method.
+func CrackHMACSecret(ctx context.Context, token string, wordlist io.Reader, workers int, counter *CrackCounter) (CrackResult, error) {
+	token = strings.TrimSpace(token)
+
+	parsed, parts, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return CrackResult{}, err
+	}
+
+	method, ok := parsed.Method.(*jwt.SigningMethodHMAC)
+	if !ok {
+		return CrackResult{}, fmt.Errorf("%s token is not signed with an HMAC secret", parsed.Method.Alg())
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return CrackResult{}, fmt.Errorf("invalid signature: %w", err)
+	}
+	signingString := parts[0] + "." + parts[1]
+
+	if counter == nil {
+		counter = &CrackCounter{}
+	}
+	workers = max(workers, 1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan []string, workers)
+	found := make(chan string, 1)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if ctx.Err() != nil {
+					return
+				}
+				for i, candidate := range batch {
+					if method.Verify(signingString, signature, []byte(candidate)) == nil {
+						counter.Tried.Add(int64(i + 1))
+						select {
+						case found <- candidate:
+						default:
+						}
+						cancel()
+						return
+					}
+				}
+				counter.Tried.Add(int64(len(batch)))
+			}
+		}()
+	}
+
+	readErr := readCandidates(ctx, wordlist, batches, counter)
+	close(batches)
+	wg.Wait()
+
+	result := CrackResult{Algorithm: method.Alg(), Tried: counter.Tried.Load()}
+	select {
+	case secret := <-found:
+		result.Found = true
+		result.Secret = secret
+		return result, nil
+	default:
+	}
+
+	if readErr != nil {
+		return result, readErr
+	}
+
+	return result, ctx.Err()
+}
+
+// readCandidates sends the wordlist's lines in batches until it ends or ctx
+// is done.
+func readCandidates(ctx context.Context, wordlist io.Reader, batches chan<- []string, counter *CrackCounter) error {
+	scanner := bufio.NewScanner(wordlist)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	batch := make([]string, 0, crackBatchSize)
+	send := func() bool {
+		select {
+		case batches <- batch:
+			batch = make([]string, 0, crackBatchSize)
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		counter.BytesRead.Add(int64(len(line)) + 1)
+
+		batch = append(batch, strings.TrimSuffix(line, "\r"))
+		if len(batch) == crackBatchSize && !send() {
+			return nil
+		}
+	}
+
+	if len(batch) > 0 {
+		send()
+	}
+
+	return scanner.Err()
+}
+
+// FormatCrackProgress describes how far a crack has come, with the share of
+// the wordlist read when its size is known.
+func FormatCrackProgress(counter *CrackCounter, size int64) string {
+	tried := counter.Tried.Load()
+	if size <= 0 {
+		return fmt.Sprintf("Tried %d candidates", tried)
+	}
+
+	percent := min(100, counter.BytesRead.Load()*100/size)
+	return fmt.Sprintf("Tried %d candidates (%d%%)", tried, percent)
+}
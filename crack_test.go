@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestCrackHMACSecret(t *testing.T) {
+	token := signTestToken(t, jwt.MapClaims{"sub": "alice"}, "letmein")
+
+	tests := []struct {
+		name     string
+		wordlist string
+		workers  int
+		found    bool
+		tried    int64
+	}{
+		{"first candidate", "letmein\npassword\n", 1, true, 1},
+		{"last candidate", "password\n123456\nletmein\n", 1, true, 3},
+		{"CRLF line endings", "password\r\nletmein\r\n", 2, true, 2},
+		{"not in wordlist", "password\n123456\n", 4, false, 2},
+		{"empty wordlist", "", 2, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var counter CrackCounter
+			result, err := CrackHMACSecret(context.Background(), token, strings.NewReader(tt.wordlist), tt.workers, &counter)
+			if err != nil {
+				t.Fatalf("CrackHMACSecret: %v", err)
+			}
+
+			if result.Found != tt.found || (tt.found && result.Secret != "letmein") {
+				t.Errorf("found %v %q, want %v", result.Found, result.Secret, tt.found)
+			}
+			if result.Tried != tt.tried {
+				t.Errorf("tried = %d, want %d", result.Tried, tt.tried)
+			}
+			if result.Algorithm != "HS256" {
+				t.Errorf("algorithm = %q, want HS256", result.Algorithm)
+			}
+		})
+	}
+}
+
+func TestCrackHMACSecretRejectsAsymmetricTokens(t *testing.T) {
+	key := testKey(t, KeyKindECP256)
+	token := signTestTokenWithKey(t, key, "")
+
+	if _, err := CrackHMACSecret(context.Background(), token, strings.NewReader("secret\n"), 1, nil); err == nil {
+		t.Error("CrackHMACSecret accepted an ES256 token")
+	}
+}
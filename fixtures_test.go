@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fixtureParts splits a fixture into its decoded header, payload segment,
+// signing string and signature.
+func fixtureParts(t *testing.T, fixture AttackFixture) (map[string]any, string, string, []byte) {
+	t.Helper()
+
+	parts := strings.Split(fixture.Token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("%s: %d parts, want 3", fixture.Label, len(parts))
+	}
+
+	var header map[string]any
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err == nil {
+		err = json.Unmarshal(raw, &header)
+	}
+	if err != nil {
+		t.Fatalf("%s: header: %v", fixture.Label, err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("%s: signature: %v", fixture.Label, err)
+	}
+
+	return header, parts[1], parts[0] + "." + parts[1], signature
+}
+
+// attackerKey is generated once, RSA key generation is slow.
+var attackerKey = sync.OnceValues(GenerateAttackerKey)
+
+func testAttackerKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := attackerKey()
+	if err != nil {
+		t.Fatalf("GenerateAttackerKey: %v", err)
+	}
+	return key
+}
+
+func fixturesByLabel(t *testing.T, token, publicKey string) map[string]AttackFixture {
+	t.Helper()
+
+	fixtures, err := GenerateAttackFixtures(token, publicKey, testAttackerKey(t))
+	if err != nil {
+		t.Fatalf("GenerateAttackFixtures: %v", err)
+	}
+
+	byLabel := make(map[string]AttackFixture, len(fixtures))
+	for _, f := range fixtures {
+		byLabel[f.Label] = f
+	}
+	return byLabel
+}
+
+func TestGenerateAttackFixtures(t *testing.T) {
+	key := testKey(t, KeyKindECP384)
+	token := signTestTokenWithKey(t, key, key.KeyID)
+	payload := strings.Split(token, ".")[1]
+
+	fixtures := fixturesByLabel(t, token, key.PublicPEM)
+	if len(fixtures) != len(noneCasings)+4 {
+		t.Errorf("%d fixtures, want %d", len(fixtures), len(noneCasings)+4)
+	}
+
+	for label, fixture := range fixtures {
+		header, gotPayload, _, _ := fixtureParts(t, fixture)
+		if gotPayload != payload {
+			t.Errorf("%s: payload changed", label)
+		}
+		if header["kid"] == nil {
+			t.Errorf("%s: dropped the original kid", label)
+		}
+	}
+
+	for _, none := range noneCasings {
+		header, _, _, signature := fixtureParts(t, fixtures["alg_none/"+none])
+		if header["alg"] != none || len(signature) != 0 {
+			t.Errorf("alg_none/%s: alg %v with a %d byte signature", none, header["alg"], len(signature))
+		}
+	}
+
+	if got, want := fixtures["signature_stripped"].Token, strings.Join(strings.Split(token, ".")[:2], ".")+"."; got != want {
+		t.Errorf("signature_stripped = %s, want %s", got, want)
+	}
+
+	// ES384 confuses into HS384, signed with the public key PEM.
+	secrets := map[string]string{
+		"key_confusion":            key.PublicPEM,
+		"key_confusion/no_newline": strings.TrimSuffix(key.PublicPEM, "\n"),
+	}
+	for label, secret := range secrets {
+		header, _, signingString, signature := fixtureParts(t, fixtures[label])
+		if header["alg"] != "HS384" {
+			t.Errorf("%s: alg = %v, want HS384", label, header["alg"])
+		}
+		if err := jwt.SigningMethodHS384.Verify(signingString, signature, []byte(secret)); err != nil {
+			t.Errorf("%s: HMAC over the public key: %v", label, err)
+		}
+	}
+
+	// The embedded jwk fixture verifies with the key in its own header.
+	header, _, signingString, signature := fixtureParts(t, fixtures["embedded_jwk"])
+	raw, _ := json.Marshal(header["jwk"])
+	var jwk jose.JSONWebKey
+	if err := jwk.UnmarshalJSON(raw); err != nil {
+		t.Fatalf("embedded_jwk: jwk header: %v", err)
+	}
+	if header["alg"] != "RS256" || header["kid"] != jwk.KeyID {
+		t.Errorf("embedded_jwk: alg %v, kid %v, want RS256 and %s", header["alg"], header["kid"], jwk.KeyID)
+	}
+	if err := jwt.SigningMethodRS256.Verify(signingString, signature, jwk.Key); err != nil {
+		t.Errorf("embedded_jwk: signature: %v", err)
+	}
+}
+
+func TestGenerateAttackFixturesPublicKeyForms(t *testing.T) {
+	key := testKey(t, KeyKindRSA2048)
+	token := signTestTokenWithKey(t, key, "")
+
+	publicKey, err := ParseVerificationKeyFromPEM([]byte(key.PublicPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := strings.TrimSpace(string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PUBLIC KEY",
+		Bytes: x509.MarshalPKCS1PublicKey(publicKey.(*rsa.PublicKey)),
+	})))
+	jwk, err := json.Marshal(testKeySet(t, key).Keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A set with a second key is picked from by the token's kid.
+	set, err := json.Marshal(jose.JSONWebKeySet{Keys: append(testKeySet(t, testKey(t, KeyKindECP256)).Keys, testKeySet(t, key).Keys...)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kidToken := signTestTokenWithKey(t, key, key.KeyID)
+
+	tests := []struct {
+		name      string
+		token     string
+		publicKey string
+		secrets   map[string]string
+	}{
+		{"JWK", token, string(jwk), map[string]string{"key_confusion": key.PublicPEM}},
+		{"JWK Set", token, string(key.JWKS), map[string]string{"key_confusion": key.PublicPEM}},
+		{"JWK Set by kid", kidToken, string(set), map[string]string{"key_confusion": key.PublicPEM}},
+		{
+			"PKCS#1 PEM",
+			token,
+			pkcs1,
+			map[string]string{
+				"key_confusion":                     key.PublicPEM,
+				"key_confusion/as_given":            pkcs1 + "\n",
+				"key_confusion/as_given_no_newline": pkcs1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixtures := fixturesByLabel(t, tt.token, tt.publicKey)
+
+			for label, secret := range tt.secrets {
+				fixture, ok := fixtures[label]
+				if !ok {
+					t.Errorf("no %s fixture", label)
+					continue
+				}
+				header, _, signingString, signature := fixtureParts(t, fixture)
+				if header["alg"] != "HS256" {
+					t.Errorf("%s: alg = %v, want HS256", label, header["alg"])
+				}
+				if err := jwt.SigningMethodHS256.Verify(signingString, signature, []byte(secret)); err != nil {
+					t.Errorf("%s: HMAC over the public key: %v", label, err)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateAttackFixturesErrors(t *testing.T) {
+	key := testKey(t, KeyKindECP256)
+	token := signTestTokenWithKey(t, key, "")
+	set, err := json.Marshal(jose.JSONWebKeySet{Keys: append(testKeySet(t, key).Keys, testKeySet(t, testKey(t, KeyKindRSA2048)).Keys...)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GenerateAttackFixtures("header.payload", "", testAttackerKey(t)); err == nil {
+		t.Error("accepted a token with 2 parts")
+	}
+	if _, err := GenerateAttackFixtures("bm90IGpzb24.e30.", "", testAttackerKey(t)); err == nil {
+		t.Error("accepted a header that is not JSON")
+	}
+	if _, err := GenerateAttackFixtures(token, "not a key", testAttackerKey(t)); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("invalid public key: error = %v, want %v", err, ErrInvalidPublicKey)
+	}
+	if _, err := GenerateAttackFixtures(token, string(set), testAttackerKey(t)); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("JWK Set without a kid: error = %v, want %v", err, ErrInvalidPublicKey)
+	}
+	if _, err := GenerateAttackFixtures(signTestTokenWithKey(t, key, "unknown"), string(set), testAttackerKey(t)); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("JWK Set without the kid: error = %v, want %v", err, ErrInvalidPublicKey)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IDTokenExpectations are the values an OpenID Connect ID token is validated
+// against. Empty fields skip the rules that need them.
+type IDTokenExpectations struct {
+	ClientID          string
+	Nonce             string
+	AccessToken       string
+	AuthorizationCode string
+	MaxAge            time.Duration
+}
+
+// JWTCheck is a single rule of a validation profile and its outcome.
+type JWTCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message"`
+}
+
+// FormatChecks renders checks as a list with a pass or fail mark per line.
+func FormatChecks(checks []JWTCheck) string {
+	lines := make([]string, 0, len(checks))
+	for _, c := range checks {
+		mark := "✗"
+		if c.Passed {
+			mark = "✓"
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: %s", mark, c.Name, c.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ValidateIDToken applies the ID token validation rules of OpenID Connect
+// Core 1.0 section 3.1.3.7, plus the at_hash and c_hash checks of sections
+// 3.2.2.9 and 3.3.2.11, to a decoded token. Time based rules allow for the
+// given clock skew.
+func ValidateIDToken(result *JWTDecodeResult, expected IDTokenExpectations, issuer string, now time.Time, leeway time.Duration) []JWTCheck {
+	var checks []JWTCheck
+	check := func(name string, passed bool, format string, args ...any) {
+		checks = append(checks, JWTCheck{Name: name, Passed: passed, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if result.Token == nil {
+		check("token", false, "token could not be decoded")
+		return checks
+	}
+
+	claims, _ := result.Token.Claims.(jwt.MapClaims)
+
+	if issuer != "" {
+		iss, _ := claims["iss"].(string)
+		check("iss", iss == issuer, "iss %q must equal the issuer %q", iss, issuer)
+	}
+
+	aud, _ := claims.GetAudience()
+	if expected.ClientID != "" {
+		check("aud", slices.Contains(aud, expected.ClientID), "aud %v must contain the client_id %q", []string(aud), expected.ClientID)
+	} else {
+		check("aud", len(aud) > 0, "aud must be present")
+	}
+
+	azp, hasAZP := claims["azp"].(string)
+	if len(aud) > 1 {
+		check("azp", hasAZP, "azp must be present when there are multiple audiences")
+	}
+	if hasAZP && expected.ClientID != "" {
+		check("azp", azp == expected.ClientID, "azp %q must equal the client_id %q", azp, expected.ClientID)
+	}
+
+	check("signature", result.IsSignatureValid(), "signature must verify with the issuer's key")
+
+	if exp, err := claims.GetExpirationTime(); err != nil || exp == nil {
+		check("exp", false, "exp must be present")
+	} else {
+		check("exp", now.Before(exp.Time.Add(leeway)), "exp %s must be in the future", exp.Time.Format(time.RFC3339))
+	}
+
+	if iat, err := claims.GetIssuedAt(); err != nil || iat == nil {
+		check("iat", false, "iat must be present")
+	} else {
+		check("iat", !iat.Time.After(now.Add(leeway)), "iat %s must not be in the future", iat.Time.Format(time.RFC3339))
+	}
+
+	if expected.Nonce != "" {
+		nonce, _ := claims["nonce"].(string)
+		check("nonce", nonce == expected.Nonce, "nonce %q must equal %q", nonce, expected.Nonce)
+	}
+
+	if expected.AccessToken != "" {
+		checks = append(checks, hashClaimCheck(claims, "at_hash", "access token", expected.AccessToken, result.SignatureAlgorithm()))
+	}
+
+	if expected.AuthorizationCode != "" {
+		checks = append(checks, hashClaimCheck(claims, "c_hash", "authorization code", expected.AuthorizationCode, result.SignatureAlgorithm()))
+	}
+
+	if expected.MaxAge > 0 {
+		authTime, ok := NumericDateClaim(claims, "auth_time")
+		if !ok {
+			check("auth_time", false, "auth_time must be present when max_age is requested")
+		} else {
+			deadline := authTime.Add(expected.MaxAge + leeway)
+			check("auth_time", !now.After(deadline), "auth_time %s plus max_age %s must not have passed", authTime.Format(time.RFC3339), expected.MaxAge)
+		}
+	}
+
+	return checks
+}
+
+// hashClaimCheck verifies an at_hash or c_hash claim: the base64url encoded
+// left half of the value's hash, using the hash of the token's alg.
+func hashClaimCheck(claims jwt.MapClaims, name, what, value, alg string) JWTCheck {
+	claim, _ := claims[name].(string)
+	if claim == "" {
+		return JWTCheck{Name: name, Message: fmt.Sprintf("%s must be present to bind the %s", name, what)}
+	}
+
+	expected, err := LeftHalfHash(alg, value)
+	if err != nil {
+		return JWTCheck{Name: name, Message: err.Error()}
+	}
+
+	return JWTCheck{
+		Name:    name,
+		Passed:  subtle.ConstantTimeCompare([]byte(claim), []byte(expected)) == 1,
+		Message: fmt.Sprintf("%s %q must match the %s hash %q", name, claim, what, expected),
+	}
+}
+
+// LeftHalfHash computes the at_hash / c_hash value of s for the given alg.
+func LeftHalfHash(alg, s string) (string, error) {
+	var hash crypto.Hash
+	switch {
+	case alg == "EdDSA", strings.HasSuffix(alg, "512"):
+		hash = crypto.SHA512
+	case strings.HasSuffix(alg, "384"):
+		hash = crypto.SHA384
+	case strings.HasSuffix(alg, "256"):
+		hash = crypto.SHA256
+	default:
+		return "", fmt.Errorf("no hash is defined for alg %q", alg)
+	}
+
+	h := hash.New()
+	h.Write([]byte(s))
+	sum := h.Sum(nil)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+// NumericDateClaim reads a NumericDate claim such as exp or auth_time.
+func NumericDateClaim(claims jwt.MapClaims, name string) (time.Time, bool) {
+	var seconds float64
+	switch v := claims[name].(type) {
+	case float64:
+		seconds = v
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		seconds = f
+	default:
+		return time.Time{}, false
+	}
+
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)), true
+}
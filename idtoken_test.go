@@ -0,0 +1,133 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The access token, code and their hashes are the RS256 examples of OpenID
+// Connect Core 1.0 appendix A.3 and A.4.
+const (
+	exampleAccessToken = "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y"
+	exampleAtHash      = "77QmUPtjPfzWtF2AnpK9RQ"
+	exampleCode        = "Qcb0Orv1zh30vL1MPRsbm-diHiMwcLyZvn1arpZv-Jxf_11jnpEX3Tgfvk"
+	exampleCHash       = "LDktKdoQak3Pk0cnXxCltA"
+)
+
+func TestLeftHalfHash(t *testing.T) {
+	tests := []struct {
+		alg, value, want string
+	}{
+		{"RS256", exampleAccessToken, exampleAtHash},
+		{"RS256", exampleCode, exampleCHash},
+		{"HS256", exampleAccessToken, exampleAtHash},
+	}
+
+	for _, tt := range tests {
+		got, err := LeftHalfHash(tt.alg, tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("LeftHalfHash(%s, %q) = %q, %v, want %q", tt.alg, tt.value, got, err, tt.want)
+		}
+	}
+
+	// EdDSA uses SHA-512, like the 512 algorithms.
+	eddsa, _ := LeftHalfHash("EdDSA", exampleAccessToken)
+	es512, _ := LeftHalfHash("ES512", exampleAccessToken)
+	if eddsa != es512 || len(eddsa) != 43 {
+		t.Errorf("EdDSA hash %q, ES512 hash %q, want the same 32 byte value", eddsa, es512)
+	}
+
+	if _, err := LeftHalfHash("none", exampleAccessToken); err == nil {
+		t.Error("LeftHalfHash(none) succeeded")
+	}
+}
+
+func TestValidateIDToken(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) int64 { return now.Add(d).Unix() }
+	claims := func(edit func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":       "https://issuer.example",
+			"sub":       "alice",
+			"aud":       "client",
+			"iat":       at(-time.Minute),
+			"exp":       at(time.Hour),
+			"auth_time": at(-10 * time.Minute),
+			"nonce":     "n-0S6_WzA2Mj",
+			"at_hash":   exampleAtHash,
+			"c_hash":    exampleCHash,
+		}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	expected := IDTokenExpectations{
+		ClientID:          "client",
+		Nonce:             "n-0S6_WzA2Mj",
+		AccessToken:       exampleAccessToken,
+		AuthorizationCode: exampleCode,
+		MaxAge:            time.Hour,
+	}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		secret string
+		failed []string
+	}{
+		{"valid", claims(nil), "secret", nil},
+		{"wrong key", claims(nil), "other", []string{"signature"}},
+		{"other issuer", claims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }), "secret", []string{"iss"}},
+		{"other audience", claims(func(c jwt.MapClaims) { c["aud"] = "other" }), "secret", []string{"aud"}},
+		{"multiple audiences without azp", claims(func(c jwt.MapClaims) { c["aud"] = []string{"client", "api"} }), "secret", []string{"azp"}},
+		{"multiple audiences with azp", claims(func(c jwt.MapClaims) { c["aud"] = []string{"client", "api"}; c["azp"] = "client" }), "secret", nil},
+		{"azp of another client", claims(func(c jwt.MapClaims) { c["azp"] = "other" }), "secret", []string{"azp"}},
+		{"expired", claims(func(c jwt.MapClaims) { c["exp"] = at(-time.Minute) }), "secret", []string{"exp"}},
+		{"no exp", claims(func(c jwt.MapClaims) { delete(c, "exp") }), "secret", []string{"exp"}},
+		{"issued in the future", claims(func(c jwt.MapClaims) { c["iat"] = at(time.Hour) }), "secret", []string{"iat"}},
+		{"no iat", claims(func(c jwt.MapClaims) { delete(c, "iat") }), "secret", []string{"iat"}},
+		{"replayed nonce", claims(func(c jwt.MapClaims) { c["nonce"] = "other" }), "secret", []string{"nonce"}},
+		{"at_hash of another token", claims(func(c jwt.MapClaims) { c["at_hash"] = exampleCHash }), "secret", []string{"at_hash"}},
+		{"no c_hash", claims(func(c jwt.MapClaims) { delete(c, "c_hash") }), "secret", []string{"c_hash"}},
+		{"auth_time too old", claims(func(c jwt.MapClaims) { c["auth_time"] = at(-2 * time.Hour) }), "secret", []string{"auth_time"}},
+		{"no auth_time", claims(func(c jwt.MapClaims) { delete(c, "auth_time") }), "secret", []string{"auth_time"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := JWTDecodeToken(signTestToken(t, tt.claims, "secret"), JWTDecodeOptions{Secret: tt.secret, At: now})
+			checks := ValidateIDToken(result, expected, "https://issuer.example", now, 0)
+
+			var failed []string
+			for _, c := range checks {
+				if !c.Passed {
+					failed = append(failed, c.Name)
+				}
+			}
+			if !slices.Equal(failed, tt.failed) {
+				t.Errorf("failed checks %v, want %v\n%s", failed, tt.failed, FormatChecks(checks))
+			}
+		})
+	}
+}
+
+func TestValidateIDTokenLeeway(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	token := signTestToken(t, jwt.MapClaims{
+		"iss": "https://issuer.example",
+		"aud": "client",
+		"iat": now.Add(30 * time.Second).Unix(),
+		"exp": now.Add(-30 * time.Second).Unix(),
+	}, "secret")
+	result := JWTDecodeToken(token, JWTDecodeOptions{Secret: "secret", At: now, Leeway: time.Minute})
+
+	for _, c := range ValidateIDToken(result, IDTokenExpectations{ClientID: "client"}, "https://issuer.example", now, time.Minute) {
+		if !c.Passed {
+			t.Errorf("%s failed within the leeway: %s", c.Name, c.Message)
+		}
+	}
+}
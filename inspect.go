@@ -0,0 +1,238 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Severity ranks how much a finding weakens a token.
+type Severity string
+
+const (
+	SeverityHigh   Severity = "high"
+	SeverityMedium Severity = "medium"
+	SeverityLow    Severity = "low"
+)
+
+// severityRank orders findings, most severe first.
+var severityRank = map[Severity]int{
+	SeverityHigh:   0,
+	SeverityMedium: 1,
+	SeverityLow:    2,
+}
+
+// Finding is a weakness spotted while auditing a token.
+type Finding struct {
+	Severity Severity `json:"severity"`
+	// Check names the rule that raised the finding, e.g. "alg_none".
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// InspectMaxLifetime is the longest lifetime not reported as too long.
+const InspectMaxLifetime = 24 * time.Hour
+
+// hmacMinKeySizes is the minimum HMAC key size of RFC 7518 section 3.2, the
+// size of the hash output.
+var hmacMinKeySizes = map[string]int{
+	"HS256": 32,
+	"HS384": 48,
+	"HS512": 64,
+}
+
+var (
+	// kidPathPattern matches key IDs that walk or name files.
+	kidPathPattern = regexp.MustCompile(`\.\.[/\\]|^[/\\]|^[A-Za-z]:\\|\x00`)
+	// kidSQLPattern matches key IDs carrying SQL or shell syntax.
+	kidSQLPattern = regexp.MustCompile(`(?i)['";` + "`" + `|]|--|/\*|\$\(|\b(union\s+select|select\s.+\sfrom|drop\s+table|or\s+\d+\s*=\s*\d+|sleep\s*\()`)
+	// emailPattern matches an email address anywhere in a string.
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+)
+
+// sensitiveClaimNames are claim names, lower case without separators, that
+// usually hold personal data.
+var sensitiveClaimNames = []string{
+	"address", "birthdate", "creditcard", "cardnumber", "dateofbirth", "dob",
+	"driverslicense", "iban", "mobile", "nationalid", "passport", "password",
+	"phone", "phonenumber", "ssn", "socialsecuritynumber", "streetaddress", "taxid",
+}
+
+// InspectToken audits a decoded token for common weaknesses. The secret is
+// only used to judge the strength of an HMAC secret that verified the token.
+func InspectToken(result *JWTDecodeResult, secret string, now time.Time) []Finding {
+	if result == nil || result.Token == nil {
+		return nil
+	}
+
+	var findings []Finding
+	add := func(severity Severity, check, format string, args ...any) {
+		findings = append(findings, Finding{Severity: severity, Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+
+	header := result.Token.Header
+	claims := plainJSON(result.Token.Claims)
+	hasClaims := result.Token.Claims != nil
+
+	alg, _ := header["alg"].(string)
+	if strings.EqualFold(alg, "none") {
+		add(SeverityHigh, "alg_none", "alg is %q, the token is not signed and any verifier accepting it can be given forged claims", alg)
+	}
+
+	if minSize, ok := hmacMinKeySizes[alg]; ok && secret != "" && result.IsSignatureValid() && !IsPEMInput(secret) && !IsJWKInput(secret) {
+		if len(secret) < minSize {
+			add(SeverityHigh, "weak_hmac_secret", "%s secret is %d bytes, at least %d are needed to resist brute force", alg, len(secret), minSize)
+		}
+	}
+
+	iss, _ := claims["iss"].(string)
+	for _, name := range []string{"jku", "x5u"} {
+		if location, ok := header[name].(string); ok {
+			if severity, reason := inspectKeyURL(location, iss); reason != "" {
+				add(severity, "untrusted_key_url", "%s %q %s", name, location, reason)
+			}
+		}
+	}
+
+	if _, ok := header["jwk"]; ok {
+		add(SeverityHigh, "embedded_jwk", "jwk header embeds the verification key, verifiers trusting it accept tokens signed with any key")
+	}
+	if _, ok := header["x5c"]; ok {
+		add(SeverityMedium, "embedded_x5c", "x5c header embeds a certificate chain, which must be validated against a trusted root")
+	}
+
+	if kid, ok := header["kid"].(string); ok {
+		switch {
+		case kidPathPattern.MatchString(kid):
+			add(SeverityHigh, "kid_injection", "kid %q looks like a file path, verifiers reading keys from disk may load the wrong file", kid)
+		case kidSQLPattern.MatchString(kid):
+			add(SeverityHigh, "kid_injection", "kid %q contains SQL or shell syntax, verifiers looking keys up by kid may be injectable", kid)
+		}
+	}
+
+	if hasClaims {
+		exp, hasExp := NumericDateClaim(claims, "exp")
+		iat, hasIAT := NumericDateClaim(claims, "iat")
+
+		switch {
+		case !hasExp:
+			add(SeverityMedium, "missing_exp", "exp is missing, the token never expires")
+		case hasIAT && exp.Sub(iat) > InspectMaxLifetime:
+			add(SeverityMedium, "long_lifetime", "lifetime is %s, longer than %s", HumanizeDuration(exp.Sub(iat)), HumanizeDuration(InspectMaxLifetime))
+		case !hasIAT && exp.Sub(now) > InspectMaxLifetime:
+			add(SeverityMedium, "long_lifetime", "expires in %s, longer than %s", HumanizeDuration(exp.Sub(now)), HumanizeDuration(InspectMaxLifetime))
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(claims)) {
+			findings = appendSensitiveFindings(findings, "claims."+name, name, claims[name])
+		}
+	}
+
+	findings = append(findings, inspectContentType(result, header)...)
+
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		return cmp.Compare(severityRank[a.Severity], severityRank[b.Severity])
+	})
+
+	return findings
+}
+
+// inspectKeyURL judges a jku or x5u header. Keys should come over https from
+// the issuer's own host.
+func inspectKeyURL(location, iss string) (Severity, string) {
+	u, err := url.Parse(location)
+	if err != nil || u.Host == "" {
+		return SeverityHigh, "is not an absolute URL"
+	}
+
+	if u.Scheme != "https" {
+		return SeverityHigh, "fetches keys without TLS"
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil || host == "localhost" {
+		return SeverityHigh, "points at an IP address or localhost, a classic SSRF target"
+	}
+
+	issuer, err := url.Parse(iss)
+	if iss == "" || err != nil || issuer.Hostname() == "" {
+		return SeverityMedium, "fetches keys from a host verifiers must allowlist, there is no issuer to compare it with"
+	}
+
+	if !strings.EqualFold(issuer.Hostname(), host) {
+		return SeverityMedium, fmt.Sprintf("fetches keys from %s rather than the issuer's host %s", host, issuer.Hostname())
+	}
+
+	return "", ""
+}
+
+// appendSensitiveFindings reports claims holding email addresses or named
+// like personal data, walking into objects and arrays.
+func appendSensitiveFindings(findings []Finding, path, name string, value any) []Finding {
+	normalized := strings.NewReplacer("_", "", "-", "", ".", "").Replace(strings.ToLower(name))
+	if slices.Contains(sensitiveClaimNames, normalized) {
+		return append(findings, Finding{Severity: SeverityMedium, Check: "sensitive_data", Message: fmt.Sprintf("%s looks like personal data, token payloads are readable by anyone holding the token", path)})
+	}
+
+	switch v := value.(type) {
+	case string:
+		if emailPattern.MatchString(v) {
+			findings = append(findings, Finding{Severity: SeverityLow, Check: "sensitive_data", Message: fmt.Sprintf("%s holds an email address, token payloads are readable by anyone holding the token", path)})
+		}
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			findings = appendSensitiveFindings(findings, path+"."+k, k, v[k])
+		}
+	case []any:
+		for i, item := range v {
+			findings = appendSensitiveFindings(findings, fmt.Sprintf("%s[%d]", path, i), name, item)
+		}
+	}
+
+	return findings
+}
+
+// inspectContentType checks that typ and cty describe what the token holds.
+func inspectContentType(result *JWTDecodeResult, header map[string]any) []Finding {
+	var findings []Finding
+
+	if typ, ok := header["typ"].(string); ok && !isJWTMediaType(typ) && !strings.EqualFold(typ, "JOSE") {
+		findings = append(findings, Finding{Severity: SeverityLow, Check: "typ_mismatch", Message: fmt.Sprintf("typ %q does not name a JWT media type", typ)})
+	}
+
+	cty, _ := header["cty"].(string)
+	nested := result.Encrypted && LooksLikeJWT(string(result.Plaintext))
+
+	switch {
+	case isJWTMediaType(cty) && !result.Encrypted:
+		findings = append(findings, Finding{Severity: SeverityMedium, Check: "cty_mismatch", Message: fmt.Sprintf("cty %q declares a nested token but the payload is a claims set", cty)})
+	case isJWTMediaType(cty) && !nested:
+		findings = append(findings, Finding{Severity: SeverityMedium, Check: "cty_mismatch", Message: fmt.Sprintf("cty %q declares a nested token but the plaintext is not one", cty)})
+	case nested && cty == "":
+		findings = append(findings, Finding{Severity: SeverityLow, Check: "cty_mismatch", Message: "the plaintext is a nested token but cty is not JWT"})
+	}
+
+	return findings
+}
+
+// isJWTMediaType reports whether a typ or cty value names a JWT, such as
+// "JWT", "at+jwt" or "application/jwt".
+func isJWTMediaType(s string) bool {
+	s = strings.TrimPrefix(strings.ToLower(s), "application/")
+	return s == "jwt" || strings.HasSuffix(s, "+jwt")
+}
+
+// FormatFindings lists findings one per line, most severe first.
+func FormatFindings(findings []Finding) string {
+	lines := make([]string, 0, len(findings))
+	for _, f := range findings {
+		lines = append(lines, fmt.Sprintf("%-6s %s: %s", strings.ToUpper(string(f.Severity)), f.Check, f.Message))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestInspectToken(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	strongSecret := "0123456789abcdef0123456789abcdef"
+	claims := func(edit func(jwt.MapClaims)) jwt.MapClaims {
+		c := jwt.MapClaims{"iss": "https://issuer.example", "sub": "alice", "iat": now.Unix(), "exp": now.Add(time.Hour).Unix()}
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]any
+		claims jwt.MapClaims
+		secret string
+		checks []string
+	}{
+		{"clean", nil, claims(nil), strongSecret, nil},
+		{"weak secret", nil, claims(nil), "secret", []string{"weak_hmac_secret"}},
+		{"jku on the issuer's host", map[string]any{"jku": "https://issuer.example/jwks.json"}, claims(nil), strongSecret, nil},
+		{"jku on another host", map[string]any{"jku": "https://keys.evil.example/jwks.json"}, claims(nil), strongSecret, []string{"untrusted_key_url"}},
+		{"x5u without TLS", map[string]any{"x5u": "http://issuer.example/cert.pem"}, claims(nil), strongSecret, []string{"untrusted_key_url"}},
+		{"jku at an IP address", map[string]any{"jku": "https://169.254.169.254/latest"}, claims(nil), strongSecret, []string{"untrusted_key_url"}},
+		{"relative jku", map[string]any{"jku": "/jwks.json"}, claims(nil), strongSecret, []string{"untrusted_key_url"}},
+		{"embedded jwk", map[string]any{"jwk": map[string]any{"kty": "oct"}}, claims(nil), strongSecret, []string{"embedded_jwk"}},
+		{"embedded x5c", map[string]any{"x5c": []string{"MIIB"}}, claims(nil), strongSecret, []string{"embedded_x5c"}},
+		{"kid path traversal", map[string]any{"kid": "../../dev/null"}, claims(nil), strongSecret, []string{"kid_injection"}},
+		{"kid SQL injection", map[string]any{"kid": "x' UNION SELECT 'key"}, claims(nil), strongSecret, []string{"kid_injection"}},
+		{"kid thumbprint", map[string]any{"kid": "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"}, claims(nil), strongSecret, nil},
+		{"no exp", nil, claims(func(c jwt.MapClaims) { delete(c, "exp") }), strongSecret, []string{"missing_exp"}},
+		{"long lifetime", nil, claims(func(c jwt.MapClaims) { c["exp"] = now.Add(48 * time.Hour).Unix() }), strongSecret, []string{"long_lifetime"}},
+		{"email", nil, claims(func(c jwt.MapClaims) { c["contact"] = "alice@example.com" }), strongSecret, []string{"sensitive_data"}},
+		{"nested personal data", nil, claims(func(c jwt.MapClaims) { c["profile"] = map[string]any{"phone_number": "555"} }), strongSecret, []string{"sensitive_data"}},
+		{"typ", map[string]any{"typ": "text/plain"}, claims(nil), strongSecret, []string{"typ_mismatch"}},
+		{"cty on a claims set", map[string]any{"cty": "JWT"}, claims(nil), strongSecret, []string{"cty_mismatch"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, tt.claims)
+			for k, v := range tt.header {
+				token.Header[k] = v
+			}
+			signed, err := token.SignedString([]byte(tt.secret))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := JWTDecodeToken(signed, JWTDecodeOptions{Secret: tt.secret, At: now})
+			findings := InspectToken(result, tt.secret, now)
+
+			var checks []string
+			for _, f := range findings {
+				checks = append(checks, f.Check)
+			}
+			if !slices.Equal(checks, tt.checks) {
+				t.Errorf("findings %v, want %v\n%s", checks, tt.checks, FormatFindings(findings))
+			}
+		})
+	}
+}
+
+func TestInspectTokenAlgNone(t *testing.T) {
+	token := "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0.eyJzdWIiOiJhbGljZSJ9."
+	findings := InspectToken(JWTDecodeToken(token, JWTDecodeOptions{}), "", time.Now())
+
+	if len(findings) == 0 || findings[0].Check != "alg_none" || findings[0].Severity != SeverityHigh {
+		t.Errorf("findings = %v, want alg_none first", findings)
+	}
+}
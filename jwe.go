@@ -0,0 +1,496 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jweKeyAlgorithms are the supported JWE key management algorithms, in the
+// order the encoder cycles through them.
+var jweKeyAlgorithms = []jose.KeyAlgorithm{
+	jose.RSA_OAEP_256,
+	jose.RSA_OAEP,
+	jose.ECDH_ES,
+	jose.ECDH_ES_A128KW,
+	jose.ECDH_ES_A192KW,
+	jose.ECDH_ES_A256KW,
+	jose.A128KW,
+	jose.A192KW,
+	jose.A256KW,
+	jose.DIRECT,
+}
+
+// jweContentEncryptions are the supported content encryption algorithms, in
+// the order the encoder cycles through them.
+var jweContentEncryptions = []jose.ContentEncryption{
+	jose.A256GCM,
+	jose.A192GCM,
+	jose.A128GCM,
+	jose.A256CBC_HS512,
+	jose.A192CBC_HS384,
+	jose.A128CBC_HS256,
+}
+
+// jweContentKeySizes maps the content encryption algorithms to the size of
+// their content encryption key in bytes.
+var jweContentKeySizes = map[jose.ContentEncryption]int{
+	jose.A128GCM:       16,
+	jose.A192GCM:       24,
+	jose.A256GCM:       32,
+	jose.A128CBC_HS256: 32,
+	jose.A192CBC_HS384: 48,
+	jose.A256CBC_HS512: 64,
+}
+
+// jweSymmetricKeyAlgorithms use a key shared with the sender, so decrypting
+// a token authenticates it like an HMAC signature does.
+var jweSymmetricKeyAlgorithms = []jose.KeyAlgorithm{
+	jose.A128KW,
+	jose.A192KW,
+	jose.A256KW,
+	jose.DIRECT,
+}
+
+// jweKeyWrapSizes maps the AES key wrap algorithms to their key size in bytes.
+var jweKeyWrapSizes = map[jose.KeyAlgorithm]int{
+	jose.A128KW: 16,
+	jose.A192KW: 24,
+	jose.A256KW: 32,
+}
+
+// IsJWECompact reports whether the token uses the five segment JWE compact
+// serialization rather than the three segment JWS one.
+func IsJWECompact(token string) bool {
+	return strings.Count(strings.TrimSpace(token), ".") == 4
+}
+
+// decodeJWE parses a JWE compact token and decrypts it with the supplied key.
+// A signed token in the plaintext is verified and its claims validated. A
+// claims set encrypted with a shared key is authenticated by it, any other
+// plaintext is reported as unsigned, with its claims validated when it is a
+// JSON object.
+func decodeJWE(token string, options JWTDecodeOptions) *JWTDecodeResult {
+	token = strings.TrimSpace(token)
+	result := &JWTDecodeResult{Encrypted: true}
+
+	header, err := parseJWEHeader(token)
+	if err != nil {
+		result.Error = err
+		result.Issues = append(result.Issues, IssueMalformed)
+		return result
+	}
+
+	result.Token = &jwt.Token{Raw: token, Header: header}
+	result.Algorithm, _ = header["alg"].(string)
+	result.Encryption, _ = header["enc"].(string)
+	result.KeyID, _ = header["kid"].(string)
+
+	alg := jose.KeyAlgorithm(result.Algorithm)
+	enc := jose.ContentEncryption(result.Encryption)
+
+	keyAllowed := len(options.AllowedKeyAlgorithms) == 0 || slices.Contains(options.AllowedKeyAlgorithms, result.Algorithm)
+	encAllowed := len(options.AllowedContentEncryptions) == 0 || slices.Contains(options.AllowedContentEncryptions, result.Encryption)
+	if !keyAllowed || !encAllowed {
+		result.Issues = append(result.Issues, IssueAlgNotAllowed)
+	}
+
+	if !slices.Contains(jweKeyAlgorithms, alg) {
+		result.KeyError = fmt.Errorf("%q key management is not supported", result.Algorithm)
+		result.Issues = append(result.Issues, IssueUndecryptable)
+		return result
+	}
+
+	if !slices.Contains(jweContentEncryptions, enc) {
+		result.KeyError = fmt.Errorf("%q content encryption is not supported", result.Encryption)
+		result.Issues = append(result.Issues, IssueUndecryptable)
+		return result
+	}
+
+	object, err := jose.ParseEncryptedCompact(token, jweKeyAlgorithms, jweContentEncryptions)
+	if err != nil {
+		result.Error = err
+		result.Issues = append(result.Issues, IssueMalformed)
+		return result
+	}
+
+	keys, err := ResolveDecryptionKeys(alg, enc, result.KeyID, options.Secret, options.Passphrase)
+	if err != nil {
+		result.KeyError = err
+		result.Issues = append(result.Issues, IssueUndecryptable)
+		return result
+	}
+
+	for _, key := range keys {
+		if result.Plaintext, err = object.Decrypt(key.key); err == nil {
+			if key.kid != "" {
+				result.KeyID = key.kid
+			}
+			break
+		}
+	}
+
+	if result.Plaintext == nil {
+		result.Error = err
+		result.Issues = append(result.Issues, IssueDecryptionFailed)
+		return result
+	}
+
+	if plaintext := strings.TrimSpace(string(result.Plaintext)); LooksLikeJWT(plaintext) && !IsJWECompact(plaintext) {
+		verifyNestedJWS(result, plaintext, options)
+		return result
+	}
+
+	var claims jwt.MapClaims
+	isClaims := json.Unmarshal(result.Plaintext, &claims) == nil && claims != nil
+
+	if !isClaims || !slices.Contains(jweSymmetricKeyAlgorithms, alg) {
+		result.Issues = append(result.Issues, IssueUnsigned)
+	}
+
+	if isClaims {
+		result.Token.Claims = claims
+		result.Token.Valid = !result.Has(IssueUnsigned)
+		result.Issues = append(result.Issues, classifyClaimsError(jwt.NewValidator(claimsParserOptions(options)...).Validate(claims))...)
+	}
+
+	return result
+}
+
+// verifyNestedJWS verifies the signed token decrypted from a JWE, taking its
+// claims and issues. The secret is the decryption key, so a key set, such as
+// the issuer's, verifies the nested token when there is one.
+func verifyNestedJWS(result *JWTDecodeResult, token string, options JWTDecodeOptions) {
+	// The validation profiles run once over the JWE with the nested claims.
+	nested := options
+	nested.Audience = options.ExpectedAudience()
+	nested.IDToken, nested.Policy, nested.Schema, nested.Rules = nil, nil, nil, nil
+	if nested.KeySet != nil {
+		nested.Secret = ""
+	}
+
+	signed := JWTDecodeToken(token, nested)
+	if !signed.IsTokenValid() {
+		result.Issues = append(result.Issues, IssueUnsigned)
+		return
+	}
+
+	result.Signed = signed
+	result.Token.Claims = signed.Token.Claims
+	result.Token.Valid = signed.Token.Valid
+	for _, issue := range signed.Issues {
+		if !result.Has(issue) {
+			result.Issues = append(result.Issues, issue)
+		}
+	}
+}
+
+// parseJWEHeader decodes the protected header of a JWE compact token.
+func parseJWEHeader(token string) (map[string]any, error) {
+	segment, _, _ := strings.Cut(token, ".")
+
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return nil, fmt.Errorf("JWE header is not base64url encoded: %w", err)
+	}
+
+	var header map[string]any
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, fmt.Errorf("JWE header is not a JSON object: %w", err)
+	}
+
+	return header, nil
+}
+
+type decryptionKey struct {
+	key any
+	kid string
+}
+
+// ResolveDecryptionKeys converts the secret entered in the decoder into the
+// keys to try for a JWE with the given algorithms: the matching keys of a JWK
+// Set, a PEM private key, or a symmetric key given as text, hex or base64.
+// The passphrase is only used when the secret is an encrypted PEM private key.
+func ResolveDecryptionKeys(alg jose.KeyAlgorithm, enc jose.ContentEncryption, kid, secret, passphrase string) ([]decryptionKey, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("%s token but no decryption key was supplied", alg)
+	}
+
+	if IsJWKInput(secret) {
+		set, err := ParseJWKSet([]byte(secret))
+		if err != nil {
+			return nil, err
+		}
+		return jwkDecryptionKeys(alg, enc, kid, set)
+	}
+
+	if IsPEMInput(secret) {
+		key, err := ParsePrivateKeyFromPEM([]byte(secret), passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("%s token but the PEM key could not be parsed: %w", alg, err)
+		}
+
+		key, err = MatchDecryptionKey(alg, enc, key)
+		if err != nil {
+			return nil, err
+		}
+		return []decryptionKey{{key: key}}, nil
+	}
+
+	key, err := parseSymmetricKey(alg, enc, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return []decryptionKey{{key: key}}, nil
+}
+
+// parseSymmetricKey reads the key for the AES key wrap and direct modes,
+// taking the secret as is when it has the right length and decoding it from
+// hex or base64 otherwise.
+func parseSymmetricKey(alg jose.KeyAlgorithm, enc jose.ContentEncryption, secret string) ([]byte, error) {
+	size := symmetricKeySize(alg, enc)
+	if size == 0 {
+		return nil, fmt.Errorf("%s token but a symmetric key was supplied", alg)
+	}
+
+	if len(secret) == size {
+		return []byte(secret), nil
+	}
+
+	raw, err := decodeRawKey(secret)
+	if err != nil || len(raw) != size {
+		return nil, fmt.Errorf("%s with %s needs a %d-byte key as text, hex or base64", alg, enc, size)
+	}
+
+	return raw, nil
+}
+
+// MatchDecryptionKey checks that an already parsed key can decrypt tokens
+// using the given key management algorithm.
+func MatchDecryptionKey(alg jose.KeyAlgorithm, enc jose.ContentEncryption, key any) (any, error) {
+	switch alg {
+	case jose.RSA_OAEP, jose.RSA_OAEP_256:
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			return rsaKey, nil
+		}
+	case jose.ECDH_ES, jose.ECDH_ES_A128KW, jose.ECDH_ES_A192KW, jose.ECDH_ES_A256KW:
+		if ecKey, ok := key.(*ecdsa.PrivateKey); ok {
+			return ecKey, nil
+		}
+	default:
+		if secret, ok := key.([]byte); ok {
+			if size := symmetricKeySize(alg, enc); len(secret) != size {
+				return nil, fmt.Errorf("%s with %s needs a %d-byte key, got %d bytes", alg, enc, size, len(secret))
+			}
+			return secret, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s token but %s was supplied", alg, KeyTypeName(key))
+}
+
+// jwkDecryptionKeys returns the keys of the set that can decrypt the token,
+// those whose kid matches the header first.
+func jwkDecryptionKeys(alg jose.KeyAlgorithm, enc jose.ContentEncryption, kid string, set *jose.JSONWebKeySet) ([]decryptionKey, error) {
+	candidates := set.Keys
+	if kid != "" {
+		if matching := set.Key(kid); len(matching) > 0 {
+			candidates = matching
+		}
+	}
+
+	var keys []decryptionKey
+	var lastErr error
+	for _, jwk := range candidates {
+		if jwk.Use == "sig" || (jwk.Algorithm != "" && jwk.Algorithm != string(alg)) {
+			continue
+		}
+
+		key, err := MatchDecryptionKey(alg, enc, jwk.Key)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		keys = append(keys, decryptionKey{key: key, kid: jwk.KeyID})
+	}
+
+	if len(keys) == 0 {
+		if lastErr != nil && len(candidates) == 1 {
+			return nil, lastErr
+		}
+		return nil, fmt.Errorf("%s token but no key in the JWK Set can decrypt it", alg)
+	}
+
+	return keys, nil
+}
+
+// symmetricKeySize returns the key size required by the AES key wrap and
+// direct encryption modes, or 0 for asymmetric key management.
+func symmetricKeySize(alg jose.KeyAlgorithm, enc jose.ContentEncryption) int {
+	if alg == jose.DIRECT {
+		return jweContentKeySizes[enc]
+	}
+	return jweKeyWrapSizes[alg]
+}
+
+// IsPEMInput reports whether the secret contains a PEM block.
+func IsPEMInput(secret string) bool {
+	block, _ := pem.Decode([]byte(secret))
+	return block != nil
+}
+
+// JWEEncryptOptions describes how the encoder wraps its output as a JWE.
+type JWEEncryptOptions struct {
+	KeyAlgorithm      jose.KeyAlgorithm
+	ContentEncryption jose.ContentEncryption
+	// RecipientKey is the public key PEM, JWK or symmetric key to encrypt to.
+	RecipientKey string
+	// Nested encrypts the signed token with cty JWT rather than the claims.
+	Nested bool
+}
+
+// JWTEncryptToken encodes a token and encrypts it for the recipient. A nested
+// token is signed first as JWTEncodeToken does, otherwise the claims are
+// encrypted as they are.
+func JWTEncryptToken(header map[string]interface{}, claims jwt.MapClaims, secret, passphrase string, options JWEEncryptOptions) *JWTEncodeResult {
+	var result *JWTEncodeResult
+	var plaintext []byte
+
+	if options.Nested {
+		result = JWTEncodeToken(header, claims, secret, passphrase)
+		if result.HeaderError != "" || result.SigningError != "" {
+			return result
+		}
+		plaintext = []byte(result.Token)
+	} else {
+		result = &JWTEncodeResult{}
+		payload, err := json.Marshal(claims)
+		if err != nil {
+			result.PayloadError = "Invalid payload JSON: " + err.Error()
+			return result
+		}
+		plaintext = payload
+	}
+
+	result.Token = ""
+
+	recipient, err := ParseEncryptionKey(options.KeyAlgorithm, options.ContentEncryption, options.RecipientKey)
+	if err != nil {
+		result.EncryptionError = err.Error()
+		return result
+	}
+
+	encrypterOptions := &jose.EncrypterOptions{}
+	if options.Nested {
+		encrypterOptions = encrypterOptions.WithContentType("JWT")
+	}
+
+	encrypter, err := jose.NewEncrypter(options.ContentEncryption, recipient, encrypterOptions)
+	if err != nil {
+		result.EncryptionError = "Error encrypting token: " + err.Error()
+		return result
+	}
+
+	object, err := encrypter.Encrypt(plaintext)
+	if err != nil {
+		result.EncryptionError = "Error encrypting token: " + err.Error()
+		return result
+	}
+
+	result.Token, err = object.CompactSerialize()
+	if err != nil {
+		result.EncryptionError = "Error encrypting token: " + err.Error()
+	}
+
+	return result
+}
+
+// ParseEncryptionKey converts the recipient key entered in the encoder into a
+// JWE recipient: the first suitable key of a JWK Set, a public key or
+// certificate PEM, or a symmetric key given as text, hex or base64.
+func ParseEncryptionKey(alg jose.KeyAlgorithm, enc jose.ContentEncryption, recipient string) (jose.Recipient, error) {
+	if recipient == "" {
+		return jose.Recipient{}, fmt.Errorf("%s needs a recipient key", alg)
+	}
+
+	if IsJWKInput(recipient) {
+		set, err := ParseJWKSet([]byte(recipient))
+		if err != nil {
+			return jose.Recipient{}, err
+		}
+
+		var lastErr error
+		for _, jwk := range set.Keys {
+			if jwk.Use == "sig" || (jwk.Algorithm != "" && jwk.Algorithm != string(alg)) {
+				continue
+			}
+
+			key, err := MatchEncryptionKey(alg, enc, jwkVerificationKey(jwk))
+			if err != nil {
+				lastErr = err
+				continue
+			}
+
+			return jose.Recipient{Algorithm: alg, Key: key, KeyID: jwk.KeyID}, nil
+		}
+
+		if lastErr != nil && len(set.Keys) == 1 {
+			return jose.Recipient{}, lastErr
+		}
+		return jose.Recipient{}, fmt.Errorf("no key in the JWK Set can be used with %s", alg)
+	}
+
+	if IsPEMInput(recipient) {
+		key, err := ParseVerificationKeyFromPEM([]byte(recipient))
+		if err != nil {
+			return jose.Recipient{}, fmt.Errorf("the PEM key could not be parsed: %w", err)
+		}
+
+		key, err = MatchEncryptionKey(alg, enc, key)
+		if err != nil {
+			return jose.Recipient{}, err
+		}
+		return jose.Recipient{Algorithm: alg, Key: key}, nil
+	}
+
+	key, err := parseSymmetricKey(alg, enc, recipient)
+	if err != nil {
+		return jose.Recipient{}, err
+	}
+
+	return jose.Recipient{Algorithm: alg, Key: key}, nil
+}
+
+// MatchEncryptionKey checks that an already parsed key can encrypt tokens
+// using the given key management algorithm.
+func MatchEncryptionKey(alg jose.KeyAlgorithm, enc jose.ContentEncryption, key any) (any, error) {
+	switch alg {
+	case jose.RSA_OAEP, jose.RSA_OAEP_256:
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+	case jose.ECDH_ES, jose.ECDH_ES_A128KW, jose.ECDH_ES_A192KW, jose.ECDH_ES_A256KW:
+		if ecKey, ok := key.(*ecdsa.PublicKey); ok {
+			return ecKey, nil
+		}
+	default:
+		if secret, ok := key.([]byte); ok {
+			if size := symmetricKeySize(alg, enc); len(secret) != size {
+				return nil, fmt.Errorf("%s with %s needs a %d-byte key, got %d bytes", alg, enc, size, len(secret))
+			}
+			return secret, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s needs a different key than %s", alg, KeyTypeName(key))
+}
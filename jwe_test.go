@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func encryptTestToken(t *testing.T, signer *GeneratedKey, alg string, options JWEEncryptOptions) string {
+	t.Helper()
+
+	header := map[string]any{"alg": alg, "typ": "JWT"}
+	claims := jwt.MapClaims{"sub": "alice", "aud": "client", "iss": "https://issuer.example"}
+
+	secret := ""
+	if signer != nil {
+		secret = signer.SigningKey()
+	}
+
+	result := JWTEncryptToken(header, claims, secret, "", options)
+	if result.Token == "" {
+		t.Fatalf("JWTEncryptToken: %+v", result)
+	}
+	return result.Token
+}
+
+// encryptToPKCS8Fixture encrypts claims to the public half of the PKCS#8
+// fixtures, whose encrypted forms need testPassphrase to decrypt it.
+func encryptToPKCS8Fixture(t *testing.T) string {
+	t.Helper()
+
+	plain, err := os.ReadFile("testdata/pkcs8/plain.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParsePrivateKeyFromPEM(plain, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.(crypto.Signer).Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encryptTestToken(t, nil, "none", JWEEncryptOptions{
+		KeyAlgorithm:      jose.ECDH_ES_A128KW,
+		ContentEncryption: jose.A128GCM,
+		RecipientKey:      string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	})
+}
+
+func TestDecodeJWENestedSignature(t *testing.T) {
+	recipient := testKey(t, KeyKindRSA2048)
+	signer := testKey(t, KeyKindECP256)
+	other := testKey(t, KeyKindECP384)
+
+	token := encryptTestToken(t, signer, "ES256", JWEEncryptOptions{
+		KeyAlgorithm:      jose.RSA_OAEP_256,
+		ContentEncryption: jose.A256GCM,
+		RecipientKey:      recipient.PublicPEM,
+		Nested:            true,
+	})
+
+	tests := []struct {
+		name     string
+		keySet   *jose.JSONWebKeySet
+		verified bool
+	}{
+		{"signer key set", testKeySet(t, signer), true},
+		{"other key set", testKeySet(t, other), false},
+		{"decryption key only", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := JWTDecodeToken(token, JWTDecodeOptions{Secret: recipient.PrivatePEM, KeySet: tt.keySet})
+
+			if !result.IsDecrypted() {
+				t.Fatalf("token was not decrypted: %v", result.Issues)
+			}
+			if result.Signed == nil {
+				t.Fatal("nested token was not decoded")
+			}
+			if got := result.SignatureAlgorithm(); got != "ES256" {
+				t.Errorf("SignatureAlgorithm() = %q, want ES256", got)
+			}
+			if got := result.IsSignatureValid(); got != tt.verified {
+				t.Errorf("IsSignatureValid() = %v, want %v (issues %v)", got, tt.verified, result.Issues)
+			}
+			if got := result.Valid(); got != tt.verified {
+				t.Errorf("Valid() = %v, want %v (issues %v)", got, tt.verified, result.Issues)
+			}
+
+			claims, _ := result.Token.Claims.(jwt.MapClaims)
+			if claims["sub"] != "alice" {
+				t.Errorf("claims = %v, want the nested token's", result.Token.Claims)
+			}
+
+			report := NewDecodeReport(result, true)
+			if !report.Decrypted || report.SignatureVerified != tt.verified {
+				t.Errorf("report decrypted %v, signature verified %v, want true, %v", report.Decrypted, report.SignatureVerified, tt.verified)
+			}
+		})
+	}
+}
+
+func TestDecodeJWESharedSecret(t *testing.T) {
+	secret := "0123456789abcdef0123456789abcdef"
+
+	token := encryptTestToken(t, &GeneratedKey{Kind: KeyKindHMAC, Secret: secret}, "HS256", JWEEncryptOptions{
+		KeyAlgorithm:      jose.DIRECT,
+		ContentEncryption: jose.A256GCM,
+		RecipientKey:      secret,
+		Nested:            true,
+	})
+
+	result := JWTDecodeToken(token, JWTDecodeOptions{Secret: secret})
+	if !result.IsDecrypted() || !result.IsSignatureValid() || !result.Valid() {
+		t.Errorf("decrypted %v, signature valid %v, issues %v", result.IsDecrypted(), result.IsSignatureValid(), result.Issues)
+	}
+}
+
+func TestDecodeJWEUnsigned(t *testing.T) {
+	recipient := testKey(t, KeyKindRSA2048)
+
+	// Anyone holding the public key can make this token.
+	token := encryptTestToken(t, nil, "none", JWEEncryptOptions{
+		KeyAlgorithm:      jose.RSA_OAEP_256,
+		ContentEncryption: jose.A256GCM,
+		RecipientKey:      recipient.PublicPEM,
+	})
+
+	result := JWTDecodeToken(token, JWTDecodeOptions{
+		Secret:  recipient.PrivatePEM,
+		IDToken: &IDTokenExpectations{ClientID: "client"},
+	})
+
+	if !result.IsDecrypted() {
+		t.Fatalf("token was not decrypted: %v", result.Issues)
+	}
+	if !result.Has(IssueUnsigned) {
+		t.Errorf("issues = %v, want %s", result.Issues, IssueUnsigned)
+	}
+	if result.IsSignatureValid() || result.Valid() {
+		t.Errorf("unsigned token reported as verified: %v", result.Issues)
+	}
+
+	i := slices.IndexFunc(result.Checks, func(c JWTCheck) bool { return c.Name == "signature" })
+	if i < 0 || result.Checks[i].Passed {
+		t.Errorf("ID token signature check passed for an unsigned token: %+v", result.Checks)
+	}
+
+	report := NewDecodeReport(result, true)
+	if !report.Decrypted || report.SignatureVerified || report.Valid {
+		t.Errorf("report decrypted %v, signature verified %v, valid %v", report.Decrypted, report.SignatureVerified, report.Valid)
+	}
+}
+
+func TestDecodeJWESharedKey(t *testing.T) {
+	secret := strings.Repeat("k", 32)
+
+	tests := []struct {
+		name     string
+		alg      jose.KeyAlgorithm
+		enc      jose.ContentEncryption
+		unsigned bool
+	}{
+		{"direct", jose.DIRECT, jose.A256GCM, false},
+		{"key wrap", jose.A256KW, jose.A128GCM, false},
+		{"public key", jose.RSA_OAEP_256, jose.A256GCM, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recipient, decryptionKey := secret, secret
+			if tt.unsigned {
+				key := testKey(t, KeyKindRSA2048)
+				recipient, decryptionKey = key.PublicPEM, key.PrivatePEM
+			}
+
+			token := encryptTestToken(t, nil, "none", JWEEncryptOptions{
+				KeyAlgorithm:      tt.alg,
+				ContentEncryption: tt.enc,
+				RecipientKey:      recipient,
+			})
+
+			result := JWTDecodeToken(token, JWTDecodeOptions{Secret: decryptionKey})
+			if !result.IsDecrypted() {
+				t.Fatalf("token was not decrypted: %v, key error %v", result.Issues, result.KeyError)
+			}
+			if result.Has(IssueUnsigned) != tt.unsigned || result.Valid() == tt.unsigned {
+				t.Errorf("issues = %v, want unsigned %v", result.Issues, tt.unsigned)
+			}
+
+			var stdout, stderr bytes.Buffer
+			want := ExitOK
+			if tt.unsigned {
+				want = ExitInvalid
+			}
+			if code := RunDecodeCommand([]string{"--secret", decryptionKey, token}, strings.NewReader(""), &stdout, &stderr); code != want {
+				t.Errorf("decode exit code = %d, want %d (stdout %q, stderr %q)", code, want, stdout.String(), stderr.String())
+			}
+		})
+	}
+}
+
+func TestDecodeJWEAllowedAlgorithms(t *testing.T) {
+	recipient := testKey(t, KeyKindRSA2048)
+	signer := testKey(t, KeyKindEd25519)
+
+	token := encryptTestToken(t, signer, "EdDSA", JWEEncryptOptions{
+		KeyAlgorithm:      jose.RSA_OAEP,
+		ContentEncryption: jose.A128CBC_HS256,
+		RecipientKey:      recipient.PublicPEM,
+		Nested:            true,
+	})
+
+	tests := []struct {
+		name       string
+		algorithms []string
+		keys       []string
+		encs       []string
+		want       bool
+		verified   bool
+	}{
+		{"all allowed", []string{"EdDSA"}, []string{"RSA-OAEP"}, []string{"A128CBC-HS256"}, true, true},
+		{"no restriction", nil, nil, nil, true, true},
+		{"alg not allowed", []string{"EdDSA"}, []string{"RSA-OAEP-256"}, []string{"A128CBC-HS256"}, false, true},
+		{"enc not allowed", []string{"EdDSA"}, []string{"RSA-OAEP"}, []string{"A256GCM"}, false, true},
+		{"signature alg not allowed", []string{"RS256"}, []string{"RSA-OAEP"}, []string{"A128CBC-HS256"}, false, false},
+		{"enc among the signature algorithms", []string{"EdDSA", "A128CBC-HS256"}, []string{"RSA-OAEP"}, []string{"A256GCM"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := JWTDecodeToken(token, JWTDecodeOptions{
+				Secret:                    recipient.PrivatePEM,
+				KeySet:                    testKeySet(t, signer),
+				AllowedAlgorithms:         tt.algorithms,
+				AllowedKeyAlgorithms:      tt.keys,
+				AllowedContentEncryptions: tt.encs,
+			})
+
+			if got := !result.Has(IssueAlgNotAllowed); got != tt.want {
+				t.Errorf("allowed = %v, want %v (issues %v)", got, tt.want, result.Issues)
+			}
+			if result.IsSignatureValid() != tt.verified {
+				t.Errorf("signature verified = %v, want %v (issues %v)", result.IsSignatureValid(), tt.verified, result.Issues)
+			}
+		})
+	}
+}
+
+func TestDecodeJWEEncryptedKey(t *testing.T) {
+	token := encryptToPKCS8Fixture(t)
+	encrypted, err := os.ReadFile("testdata/pkcs8/aes256.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		err        error
+	}{
+		{"passphrase", testPassphrase, nil},
+		{"no passphrase", "", ErrPassphraseRequired},
+		{"wrong passphrase", "battery-staple", ErrIncorrectPassphrase},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := JWTDecodeToken(token, JWTDecodeOptions{Secret: string(encrypted), Passphrase: tt.passphrase})
+
+			if !errors.Is(result.KeyError, tt.err) {
+				t.Errorf("key error = %v, want %v", result.KeyError, tt.err)
+			}
+			if decrypted := result.IsDecrypted(); decrypted != (tt.err == nil) {
+				t.Errorf("decrypted = %v, want %v (issues %v)", decrypted, tt.err == nil, result.Issues)
+			}
+		})
+	}
+}
+
+func TestDecodeJWEWrongKey(t *testing.T) {
+	recipient := testKey(t, KeyKindRSA2048)
+	other := testKey(t, KeyKindRSA3072)
+
+	token := encryptTestToken(t, nil, "none", JWEEncryptOptions{
+		KeyAlgorithm:      jose.RSA_OAEP_256,
+		ContentEncryption: jose.A256GCM,
+		RecipientKey:      recipient.PublicPEM,
+	})
+
+	result := JWTDecodeToken(token, JWTDecodeOptions{Secret: other.PrivatePEM})
+	if result.IsDecrypted() || !result.Has(IssueDecryptionFailed) {
+		t.Errorf("decrypted %v with the wrong key, issues %v", result.IsDecrypted(), result.Issues)
+	}
+}
+
+func TestJWTEncryptTokenRoundTrip(t *testing.T) {
+	rsaKey := testKey(t, KeyKindRSA2048)
+	ecKey := testKey(t, KeyKindECP256)
+
+	for _, alg := range jweKeyAlgorithms {
+		t.Run(string(alg), func(t *testing.T) {
+			enc := jose.A256GCM
+			recipient, decryptionKey := rsaKey.PublicPEM, rsaKey.PrivatePEM
+			switch {
+			case strings.HasPrefix(string(alg), "ECDH-ES"):
+				recipient, decryptionKey = ecKey.PublicPEM, ecKey.PrivatePEM
+			case slices.Contains(jweSymmetricKeyAlgorithms, alg):
+				recipient = strings.Repeat("k", symmetricKeySize(alg, enc))
+				decryptionKey = recipient
+			}
+
+			token := encryptTestToken(t, nil, "none", JWEEncryptOptions{
+				KeyAlgorithm:      alg,
+				ContentEncryption: enc,
+				RecipientKey:      recipient,
+			})
+
+			result := JWTDecodeToken(token, JWTDecodeOptions{Secret: decryptionKey})
+			if !result.IsDecrypted() {
+				t.Fatalf("token was not decrypted: %v, key error %v", result.Issues, result.KeyError)
+			}
+			if result.Algorithm != string(alg) || result.Encryption != string(enc) {
+				t.Errorf("alg %s, enc %s, want %s and %s", result.Algorithm, result.Encryption, alg, enc)
+			}
+			if claims, _ := result.Token.Claims.(jwt.MapClaims); claims["sub"] != "alice" {
+				t.Errorf("claims = %v, want sub alice", result.Token.Claims)
+			}
+		})
+	}
+}
+
+func TestJWTEncryptTokenUnsupported(t *testing.T) {
+	recipient := testKey(t, KeyKindRSA2048)
+
+	tests := []struct {
+		name string
+		alg  jose.KeyAlgorithm
+		enc  jose.ContentEncryption
+	}{
+		{"key algorithm", jose.PBES2_HS256_A128KW, jose.A256GCM},
+		{"content encryption", jose.RSA_OAEP_256, jose.ContentEncryption("A512GCM")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := JWTEncryptToken(map[string]any{"alg": "none"}, jwt.MapClaims{"sub": "alice"}, "", "", JWEEncryptOptions{
+				KeyAlgorithm:      tt.alg,
+				ContentEncryption: tt.enc,
+				RecipientKey:      recipient.PublicPEM,
+			})
+			if result.Token != "" || result.EncryptionError == "" {
+				t.Errorf("token %q, encryption error %q, want an error", result.Token, result.EncryptionError)
+			}
+		})
+	}
+}
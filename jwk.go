@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IsJWKInput reports whether the secret is a JWK or JWK Set rather than PEM
+// or an HMAC secret. JSON that does not parse as one is an HMAC secret.
+func IsJWKInput(secret string) bool {
+	secret = strings.TrimSpace(secret)
+	if !strings.HasPrefix(secret, "{") {
+		return false
+	}
+
+	_, err := ParseJWKSet([]byte(secret))
+	return err == nil
+}
+
+// ParseJWKSet parses either a JWK Set or a single JWK, which is treated as a
+// set with one key.
+func ParseJWKSet(data []byte) (*jose.JSONWebKeySet, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("invalid JWK JSON: %w", err)
+	}
+
+	if _, ok := probe["keys"]; ok {
+		var set jose.JSONWebKeySet
+		if err := json.Unmarshal(data, &set); err != nil {
+			return nil, fmt.Errorf("invalid JWK Set: %w", err)
+		}
+		return &set, nil
+	}
+
+	var key jose.JSONWebKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("invalid JWK: %w", err)
+	}
+
+	return &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{key}}, nil
+}
+
+// ResolveJWKSKey returns the key of the set that verifies the token and its
+// kid. Keys whose kid matches the token header are tried when there are any,
+// every compatible key otherwise. When none verifies, all of them are
+// returned for the parser to report the invalid signature.
+func ResolveJWKSKey(t *jwt.Token, set *jose.JSONWebKeySet) (any, string, error) {
+	alg := t.Method.Alg()
+
+	candidates := set.Keys
+	kid, _ := t.Header["kid"].(string)
+	if matching := set.Key(kid); kid != "" && len(matching) > 0 {
+		candidates = matching
+	} else {
+		kid = ""
+	}
+
+	signingString := t.Raw[:max(strings.LastIndex(t.Raw, "."), 0)]
+
+	var keys jwt.VerificationKeySet
+	var lastErr error
+	for _, jwk := range candidates {
+		if jwk.Use == "enc" || (jwk.Algorithm != "" && jwk.Algorithm != alg) {
+			continue
+		}
+
+		key, err := MatchVerificationKey(t.Method, jwkVerificationKey(jwk))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if t.Method.Verify(signingString, t.Signature, key) == nil {
+			return key, jwk.KeyID, nil
+		}
+		keys.Keys = append(keys.Keys, key)
+	}
+
+	if len(keys.Keys) == 0 {
+		if lastErr != nil && len(candidates) == 1 {
+			return nil, "", lastErr
+		}
+		return nil, "", fmt.Errorf("%s token but no key in the JWK Set can verify it", alg)
+	}
+
+	return keys, kid, nil
+}
+
+// jwkVerificationKey returns the public half of asymmetric JWKs and the raw
+// bytes of symmetric ones.
+func jwkVerificationKey(jwk jose.JSONWebKey) any {
+	if _, ok := jwk.Key.([]byte); ok || jwk.IsPublic() {
+		return jwk.Key
+	}
+	return jwk.Public().Key
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestIsJWKInput(t *testing.T) {
+	key := testKey(t, KeyKindECP256)
+
+	tests := []struct {
+		name   string
+		secret string
+		want   bool
+	}{
+		{"JWK Set", string(key.JWKS), true},
+		{"single JWK", string(key.PrivateJWK), true},
+		{"indented JWK", "\n  " + string(key.PrivateJWK), true},
+		{"JSON secret", `{"not":"a key"}`, false},
+		{"brace secret", "{my-secret}", false},
+		{"PEM", key.PublicPEM, false},
+		{"HMAC secret", "my-secret", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsJWKInput(tt.secret); got != tt.want {
+			t.Errorf("%s: IsJWKInput() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJWTDecodeTokenJSONSecret(t *testing.T) {
+	// A secret that starts with "{" but is not a JWK is an HMAC secret.
+	secret := `{"not":"a key"}`
+	result := JWTDecodeToken(signTestToken(t, jwt.MapClaims{"sub": "alice"}, secret), JWTDecodeOptions{Secret: secret})
+	if !result.Valid() {
+		t.Errorf("issues = %v, key error %v", result.Issues, result.KeyError)
+	}
+}
+
+func TestResolveJWKSKey(t *testing.T) {
+	signer := testKey(t, KeyKindECP256)
+	other := testKey(t, KeyKindECP384)
+	rsa := testKey(t, KeyKindRSA2048)
+
+	set := &jose.JSONWebKeySet{Keys: slices.Concat(testKeySet(t, other).Keys, testKeySet(t, rsa).Keys, testKeySet(t, signer).Keys)}
+	onlyOther := testKeySet(t, other)
+
+	tests := []struct {
+		name     string
+		token    string
+		set      *jose.JSONWebKeySet
+		verified bool
+		keyID    string
+	}{
+		{"matching kid", signTestTokenWithKey(t, signer, signer.KeyID), set, true, signer.KeyID},
+		{"no kid tries every key", signTestTokenWithKey(t, signer, ""), set, true, signer.KeyID},
+		{"unknown kid tries every key", signTestTokenWithKey(t, signer, "rotated"), set, true, signer.KeyID},
+		{"kid of another key", signTestTokenWithKey(t, signer, other.KeyID), set, false, ""},
+		{"no compatible key", signTestTokenWithKey(t, signer, ""), onlyOther, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := JWTDecodeToken(tt.token, JWTDecodeOptions{KeySet: tt.set})
+
+			if result.IsSignatureValid() != tt.verified {
+				t.Errorf("signature valid = %v, want %v (issues %v, key error %v)", result.IsSignatureValid(), tt.verified, result.Issues, result.KeyError)
+			}
+			if tt.verified && result.KeyID != tt.keyID {
+				t.Errorf("KeyID = %q, want %q", result.KeyID, tt.keyID)
+			}
+		})
+	}
+}
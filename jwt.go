@@ -1,12 +1,13 @@
 package main
 
 import (
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
+	"errors"
 	"fmt"
-	"strings"
+	"slices"
+	"time"
 
+	"github.com/go-jose/go-jose/v4"
 	"github.com/golang-jwt/jwt/v5"
 )
 
@@ -17,13 +18,78 @@ var signingMethods = map[string]jwt.SigningMethod{
 	"RS256": jwt.SigningMethodRS256,
 	"RS384": jwt.SigningMethodRS384,
 	"RS512": jwt.SigningMethodRS512,
+	"ES256": jwt.SigningMethodES256,
+	"ES384": jwt.SigningMethodES384,
+	"ES512": jwt.SigningMethodES512,
+	"PS256": jwt.SigningMethodPS256,
+	"PS384": jwt.SigningMethodPS384,
+	"PS512": jwt.SigningMethodPS512,
+	"EdDSA": jwt.SigningMethodEdDSA,
+}
+
+// ErrAlgNotAllowed is the decode error of a token whose alg is not among the
+// allowed algorithms, which is refused without checking its signature.
+var ErrAlgNotAllowed = errors.New("alg is not allowed")
+
+// JWTIssue is a single reason why a decoded token is not valid
+type JWTIssue string
+
+const (
+	IssueMalformed        JWTIssue = "malformed"
+	IssueUnverifiable     JWTIssue = "unverifiable"
+	IssueSignatureInvalid JWTIssue = "signature_invalid"
+	IssueExpired          JWTIssue = "expired"
+	IssueNotValidYet      JWTIssue = "not_valid_yet"
+	IssueIssuedInFuture   JWTIssue = "issued_in_future"
+	IssueInvalidAudience  JWTIssue = "invalid_audience"
+	IssueInvalidIssuer    JWTIssue = "invalid_issuer"
+	IssueInvalidClaims    JWTIssue = "invalid_claims"
+	IssueAlgNotAllowed    JWTIssue = "alg_not_allowed"
+	IssueIDTokenInvalid   JWTIssue = "id_token_invalid"
+	IssueUndecryptable    JWTIssue = "undecryptable"
+	IssueDecryptionFailed JWTIssue = "decryption_failed"
+	IssueUnsigned         JWTIssue = "unsigned"
+	IssuePolicyFailed     JWTIssue = "policy_failed"
+	IssueSchemaInvalid    JWTIssue = "schema_invalid"
+	IssueRulesFailed      JWTIssue = "rules_failed"
+)
+
+// claimIssues maps the golang-jwt claim validation errors to issues, in the
+// order they are reported.
+var claimIssues = []struct {
+	Err   error
+	Issue JWTIssue
+}{
+	{jwt.ErrTokenExpired, IssueExpired},
+	{jwt.ErrTokenNotValidYet, IssueNotValidYet},
+	{jwt.ErrTokenUsedBeforeIssued, IssueIssuedInFuture},
+	{jwt.ErrTokenInvalidAudience, IssueInvalidAudience},
+	{jwt.ErrTokenInvalidIssuer, IssueInvalidIssuer},
 }
 
 type JWTDecodeResult struct {
-	Token            *jwt.Token
-	Error            error
-	IsTokenValid     bool
-	IsSignatureValid bool
+	Token     *jwt.Token
+	Algorithm string
+	KeyID     string
+	Error     error
+	KeyError  error
+	Issues    []JWTIssue
+	// Encrypted is set for JWE tokens, whose Algorithm is the key management
+	// algorithm and Encryption the content encryption one.
+	Encrypted  bool
+	Encryption string
+	// Plaintext is the decrypted payload of a JWE token.
+	Plaintext []byte
+	// Signed is the decoded signed token a JWE carries as its plaintext.
+	// Anyone holding the public key can encrypt a token, so a JWE is only
+	// authenticated by this signature.
+	Signed *JWTDecodeResult
+	// Checks lists the outcome of each rule of a validation profile, such
+	// as the OpenID Connect ID token rules.
+	Checks []JWTCheck
+	// SchemaViolations lists where the header and claims do not match the
+	// schema given in the options.
+	SchemaViolations []SchemaViolation
 }
 
 func (r *JWTDecodeResult) JsonMarshaledHeader() string {
@@ -44,6 +110,11 @@ func (r *JWTDecodeResult) JsonMarshaledClaims() string {
 		return ""
 	}
 
+	// A JWE payload does not have to be JSON, show it as it is.
+	if r.Token.Claims == nil {
+		return string(r.Plaintext)
+	}
+
 	v, err := json.MarshalIndent(r.Token.Claims, "", "  ")
 	if err != nil {
 		return ""
@@ -52,76 +123,311 @@ func (r *JWTDecodeResult) JsonMarshaledClaims() string {
 	return string(v)
 }
 
+// Has reports whether the given issue was found while decoding the token.
+func (r *JWTDecodeResult) Has(issue JWTIssue) bool {
+	return slices.Contains(r.Issues, issue)
+}
+
+// IsTokenValid reports whether the token could be parsed at all.
+func (r *JWTDecodeResult) IsTokenValid() bool {
+	return !r.Has(IssueMalformed)
+}
+
+// IsSignatureValid reports whether the signature was verified. For a JWE it
+// is the signature of the nested token, decrypting it is not enough unless
+// the key is shared with the sender.
+func (r *JWTDecodeResult) IsSignatureValid() bool {
+	if r.Signed != nil && !r.Signed.IsSignatureValid() {
+		return false
+	}
+	return r.IsTokenValid() && !r.Has(IssueUnverifiable) && !r.Has(IssueSignatureInvalid) &&
+		!r.Has(IssueUnsigned) && !r.Has(IssueUndecryptable) && !r.Has(IssueDecryptionFailed) &&
+		!errors.Is(r.Error, ErrAlgNotAllowed)
+}
+
+// IsDecrypted reports whether the token is a JWE that was decrypted.
+func (r *JWTDecodeResult) IsDecrypted() bool {
+	return r.Encrypted && r.Plaintext != nil
+}
+
+// SignatureAlgorithm returns the alg of the signature, which for a JWE is
+// the one of its nested token.
+func (r *JWTDecodeResult) SignatureAlgorithm() string {
+	if r.Encrypted {
+		if r.Signed == nil {
+			return ""
+		}
+		return r.Signed.Algorithm
+	}
+	return r.Algorithm
+}
+
+// TokenIssues returns the issues found in the token itself, leaving out
+// parsing and signature problems.
+func (r *JWTDecodeResult) TokenIssues() []JWTIssue {
+	var issues []JWTIssue
+	for _, issue := range r.Issues {
+		switch issue {
+		case IssueMalformed, IssueUnverifiable, IssueSignatureInvalid, IssueUnsigned, IssueUndecryptable, IssueDecryptionFailed:
+		default:
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
 func (r *JWTDecodeResult) Valid() bool {
-	return r.Error == nil && r.IsTokenValid && r.IsSignatureValid
+	return len(r.Issues) == 0
+}
+
+// JWTDecodeOptions holds everything used to verify a token besides the token
+// itself.
+type JWTDecodeOptions struct {
+	// Secret is the HMAC secret, PEM key or JWK(S) entered by the user.
+	Secret string
+	// Passphrase decrypts the secret when it is an encrypted PEM private key.
+	Passphrase string
+	// KeySet is a resolved JWK Set, such as one fetched from a jwks_uri. It
+	// is used when no secret is given, and for a JWE to verify the token
+	// nested in it while the secret decrypts it.
+	KeySet *jose.JSONWebKeySet
+	// Issuer is the expected iss claim, checked when not empty.
+	Issuer string
+	// Audience is a value the aud claim must contain, checked when not
+	// empty. ID tokens default to their client_id.
+	Audience string
+	// AllowedAlgorithms restricts the accepted signature alg header when not
+	// empty, for a JWE the one of its nested token.
+	AllowedAlgorithms []string
+	// AllowedKeyAlgorithms restricts the key management alg header of a JWE
+	// when not empty.
+	AllowedKeyAlgorithms []string
+	// AllowedContentEncryptions restricts the enc header of a JWE when not
+	// empty.
+	AllowedContentEncryptions []string
+	// IDToken enables the OpenID Connect ID token validation profile.
+	IDToken *IDTokenExpectations
+	// At is the instant time claims are validated at, now when zero.
+	At time.Time
+	// Leeway is the clock skew allowed when validating time claims.
+	Leeway time.Duration
+	// Policy lists the expected claims and algorithms, checked when set.
+	Policy *ValidationPolicy
+	// Schema is a JSON Schema the header and claims must match, when set.
+	Schema *TokenSchema
+	// Rules are CEL expressions over the header and claims, checked when set.
+	Rules *RuleSet
+}
+
+// ExpectedAudience returns the value the aud claim must contain, if any.
+func (o JWTDecodeOptions) ExpectedAudience() string {
+	if o.Audience == "" && o.IDToken != nil {
+		return o.IDToken.ClientID
+	}
+	return o.Audience
 }
 
-func JWTDecodeToken(token, secret string) *JWTDecodeResult {
+// Now returns the instant the token is evaluated at.
+func (o JWTDecodeOptions) Now() time.Time {
+	if o.At.IsZero() {
+		return time.Now()
+	}
+	return o.At
+}
+
+func JWTDecodeToken(token string, options JWTDecodeOptions) *JWTDecodeResult {
+	if IsJWECompact(token) {
+		result := decodeJWE(token, options)
+		applyIDTokenProfile(result, options)
+		applyPolicy(result, options)
+		applySchema(result, options)
+		applyRules(result, options)
+		return result
+	}
+
+	secret := options.Secret
+	parserOptions := claimsParserOptions(options)
+
+	var keyErr error
+	var keyID string
 	parsedToken, err := jwt.Parse(token, jwt.Keyfunc(func(t *jwt.Token) (any, error) {
-		pubKey, err := ParseECDSAPublicKeyFromPEM([]byte(secret))
-		if err != nil {
-			return []byte(secret), nil
+		var key any
+		if secret == "" && options.KeySet != nil {
+			key, keyID, keyErr = ResolveJWKSKey(t, options.KeySet)
+		} else if IsJWKInput(secret) {
+			var set *jose.JSONWebKeySet
+			if set, keyErr = ParseJWKSet([]byte(secret)); keyErr == nil {
+				key, keyID, keyErr = ResolveJWKSKey(t, set)
+			}
+		} else {
+			key, keyErr = ResolveVerificationKey(t.Method, secret)
 		}
-		return pubKey, nil
-	}))
+		return key, keyErr
+	}), parserOptions...)
 
 	result := JWTDecodeResult{
-		Token:            parsedToken,
-		IsTokenValid:     true,
-		IsSignatureValid: true,
+		Token:    parsedToken,
+		KeyID:    keyID,
+		Error:    err,
+		KeyError: keyErr,
 	}
 
-	if err != nil {
-		result.IsTokenValid = !strings.Contains(err.Error(), "token is malformed")
-		result.IsSignatureValid = !strings.Contains(err.Error(), "token signature is invalid") && result.IsTokenValid
+	if parsedToken != nil && parsedToken.Method != nil {
+		result.Algorithm = parsedToken.Method.Alg()
+	}
 
-		if result.IsTokenValid && result.IsSignatureValid {
-			result.Error = err
-		}
+	switch {
+	case err == nil:
+	case len(options.AllowedAlgorithms) > 0 && result.Algorithm != "" && !slices.Contains(options.AllowedAlgorithms, result.Algorithm):
+		// The parser refuses the alg before looking up a key, the signature
+		// is never checked.
+		result.Error = fmt.Errorf("%w: %w", ErrAlgNotAllowed, err)
+		result.Issues = append(result.Issues, IssueAlgNotAllowed)
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		result.Issues = append(result.Issues, IssueMalformed)
+	case errors.Is(err, jwt.ErrTokenInvalidClaims):
+		result.Issues = append(result.Issues, classifyClaimsError(err)...)
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		result.Issues = append(result.Issues, IssueSignatureInvalid)
+	default:
+		result.Issues = append(result.Issues, IssueUnverifiable)
+	}
+
+	// Claims are only validated after the signature checks out, validate them
+	// separately so an expired token is reported even without the key.
+	if !result.IsSignatureValid() && result.IsTokenValid() && parsedToken != nil {
+		claimsErr := jwt.NewValidator(parserOptions...).Validate(parsedToken.Claims)
+		result.Issues = append(result.Issues, classifyClaimsError(claimsErr)...)
 	}
 
+	applyIDTokenProfile(&result, options)
+	applyPolicy(&result, options)
+	applySchema(&result, options)
+	applyRules(&result, options)
+
 	return &result
 }
 
-func ParseECDSAPublicKeyFromPEM(pemBytes []byte) (any, error) {
-	block, _ := pem.Decode(pemBytes)
-	if block == nil {
-		return nil, fmt.Errorf("failed to parse PEM block containing public key")
+// claimsParserOptions returns the claim validation options for a decode.
+func claimsParserOptions(options JWTDecodeOptions) []jwt.ParserOption {
+	parserOptions := []jwt.ParserOption{
+		jwt.WithIssuedAt(),
+	}
+
+	if options.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(options.Issuer))
+	}
+
+	if audience := options.ExpectedAudience(); audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(audience))
+	}
+
+	if !options.At.IsZero() {
+		parserOptions = append(parserOptions, jwt.WithTimeFunc(options.Now))
+	}
+
+	if options.Leeway > 0 {
+		parserOptions = append(parserOptions, jwt.WithLeeway(options.Leeway))
+	}
+
+	if len(options.AllowedAlgorithms) > 0 {
+		parserOptions = append(parserOptions, jwt.WithValidMethods(options.AllowedAlgorithms))
+	}
+
+	return parserOptions
+}
+
+// applyIDTokenProfile runs the ID token checks when they are enabled.
+func applyIDTokenProfile(result *JWTDecodeResult, options JWTDecodeOptions) {
+	if options.IDToken == nil {
+		return
 	}
 
-	return x509.ParsePKIXPublicKey(block.Bytes)
+	checks := ValidateIDToken(result, *options.IDToken, options.Issuer, options.Now(), options.Leeway)
+	result.Checks = append(result.Checks, checks...)
+	if slices.ContainsFunc(checks, func(c JWTCheck) bool { return !c.Passed }) {
+		result.Issues = append(result.Issues, IssueIDTokenInvalid)
+	}
+}
+
+// TokenKeyID returns the kid header of a token without verifying it.
+func TokenKeyID(token string) string {
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return ""
+	}
+
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+// classifyClaimsError converts a claims validation error into issues.
+func classifyClaimsError(err error) []JWTIssue {
+	if err == nil {
+		return nil
+	}
+
+	var issues []JWTIssue
+	for _, c := range claimIssues {
+		if errors.Is(err, c.Err) {
+			issues = append(issues, c.Issue)
+		}
+	}
+
+	if len(issues) == 0 {
+		issues = append(issues, IssueInvalidClaims)
+	}
+
+	return issues
 }
 
 type JWTEncodeResult struct {
-	Token        string
-	HeaderError  string
-	PayloadError string
-	SigningError string
+	Token           string
+	HeaderError     string
+	PayloadError    string
+	SigningError    string
+	EncryptionError string
+	// SigningErr is the error behind SigningError, for callers matching it
+	// with errors.Is.
+	SigningErr error
 }
 
-func JWTEncodeToken(header map[string]interface{}, claims jwt.MapClaims, secret string) *JWTEncodeResult {
+func JWTEncodeToken(header map[string]interface{}, claims jwt.MapClaims, secret, passphrase string) *JWTEncodeResult {
 	result := &JWTEncodeResult{}
 
+	// Without an alg the token is signed with HS256, an alg that cannot be
+	// signed with is an error rather than silently replaced.
 	var signingMethod jwt.SigningMethod = jwt.SigningMethodHS256
 	if alg, ok := header["alg"]; ok {
-		if algStr, ok := alg.(string); ok {
-			if method, exists := signingMethods[algStr]; exists {
-				signingMethod = method
-			}
+		algStr, _ := alg.(string)
+		method, exists := signingMethods[algStr]
+		if !exists {
+			result.HeaderError = fmt.Sprintf("Unsupported alg %v", alg)
+			return result
 		}
+		signingMethod = method
 	}
 
+	// typ defaults to JWT and is kept when the header sets it.
 	token := jwt.NewWithClaims(signingMethod, claims)
 
 	for k, v := range header {
-		if k != "alg" && k != "typ" { // Don't override alg and typ
+		if k != "alg" { // alg is set by the signing method
 			token.Header[k] = v
 		}
 	}
 
-	tokenString, err := token.SignedString([]byte(secret))
+	key, err := ParseSigningKey(signingMethod, secret, passphrase)
+	if err != nil {
+		result.SigningError = "Invalid signing key: " + err.Error()
+		result.SigningErr = err
+		return result
+	}
+
+	tokenString, err := token.SignedString(key)
 	if err != nil {
 		result.SigningError = "Error signing token: " + err.Error()
+		result.SigningErr = err
 		return result
 	}
 
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signTestToken(t *testing.T, claims jwt.MapClaims, secret string) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// testKeys are generated once per kind, RSA key generation is slow.
+var testKeys sync.Map
+
+func testKey(t *testing.T, kind KeyKind) *GeneratedKey {
+	t.Helper()
+
+	if key, ok := testKeys.Load(kind); ok {
+		return key.(*GeneratedKey)
+	}
+
+	key, err := GenerateKey(kind, DefaultHMACLength)
+	if err != nil {
+		t.Fatalf("GenerateKey(%s): %v", kind, err)
+	}
+	actual, _ := testKeys.LoadOrStore(kind, key)
+	return actual.(*GeneratedKey)
+}
+
+func testKeySet(t *testing.T, key *GeneratedKey) *jose.JSONWebKeySet {
+	t.Helper()
+
+	var set jose.JSONWebKeySet
+	if err := json.Unmarshal(key.JWKS, &set); err != nil {
+		t.Fatalf("unmarshal JWKS: %v", err)
+	}
+	return &set
+}
+
+func signTestTokenWithKey(t *testing.T, key *GeneratedKey, kid string) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), jwt.MapClaims{"sub": "alice"})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(mustParseSigningKey(t, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWTDecodeTokenIssues(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) int64 { return now.Add(d).Unix() }
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"sub": "alice", "iss": "https://issuer.example", "aud": "my-api", "iat": at(-time.Minute), "exp": at(time.Hour)}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		options JWTDecodeOptions
+		want    []JWTIssue
+	}{
+		{"valid", signTestToken(t, claims(nil), "secret"), JWTDecodeOptions{Secret: "secret"}, nil},
+		{"malformed", "not.a.token", JWTDecodeOptions{Secret: "secret"}, []JWTIssue{IssueMalformed}},
+		{"wrong secret", signTestToken(t, claims(nil), "secret"), JWTDecodeOptions{Secret: "other"}, []JWTIssue{IssueSignatureInvalid}},
+		{"no secret", signTestToken(t, claims(nil), "secret"), JWTDecodeOptions{}, []JWTIssue{IssueUnverifiable}},
+		{"expired", signTestToken(t, claims(jwt.MapClaims{"exp": at(-time.Second)}), "secret"), JWTDecodeOptions{Secret: "secret"}, []JWTIssue{IssueExpired}},
+		{"expired within leeway", signTestToken(t, claims(jwt.MapClaims{"exp": at(-time.Second)}), "secret"), JWTDecodeOptions{Secret: "secret", Leeway: time.Minute}, nil},
+		{"expired without key", signTestToken(t, claims(jwt.MapClaims{"exp": at(-time.Second)}), "secret"), JWTDecodeOptions{}, []JWTIssue{IssueUnverifiable, IssueExpired}},
+		{"not valid yet", signTestToken(t, claims(jwt.MapClaims{"nbf": at(time.Minute)}), "secret"), JWTDecodeOptions{Secret: "secret"}, []JWTIssue{IssueNotValidYet}},
+		{"issued in future", signTestToken(t, claims(jwt.MapClaims{"iat": at(time.Minute)}), "secret"), JWTDecodeOptions{Secret: "secret"}, []JWTIssue{IssueIssuedInFuture}},
+		{"issuer", signTestToken(t, claims(nil), "secret"), JWTDecodeOptions{Secret: "secret", Issuer: "https://other.example"}, []JWTIssue{IssueInvalidIssuer}},
+		{"audience", signTestToken(t, claims(nil), "secret"), JWTDecodeOptions{Secret: "secret", Audience: "my-api"}, nil},
+		{"wrong audience", signTestToken(t, claims(nil), "secret"), JWTDecodeOptions{Secret: "secret", Audience: "other-api"}, []JWTIssue{IssueInvalidAudience}},
+		{"wrong audience without key", signTestToken(t, claims(nil), "secret"), JWTDecodeOptions{Audience: "other-api"}, []JWTIssue{IssueUnverifiable, IssueInvalidAudience}},
+		{"audience in list", signTestToken(t, claims(jwt.MapClaims{"aud": []string{"a", "my-api"}}), "secret"), JWTDecodeOptions{Secret: "secret", Audience: "my-api"}, nil},
+		{
+			"ID token client_id is the audience",
+			signTestToken(t, claims(nil), "secret"),
+			JWTDecodeOptions{Secret: "secret", IDToken: &IDTokenExpectations{ClientID: "other-app"}},
+			[]JWTIssue{IssueInvalidAudience, IssueIDTokenInvalid},
+		},
+		{"alg not allowed", signTestToken(t, claims(nil), "secret"), JWTDecodeOptions{Secret: "secret", AllowedAlgorithms: []string{"RS256"}}, []JWTIssue{IssueAlgNotAllowed}},
+		{
+			"alg not allowed and expired",
+			signTestToken(t, claims(jwt.MapClaims{"exp": at(-time.Second)}), "secret"),
+			JWTDecodeOptions{Secret: "secret", AllowedAlgorithms: []string{"RS256"}},
+			[]JWTIssue{IssueAlgNotAllowed, IssueExpired},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.options.At = now
+			result := JWTDecodeToken(tt.token, tt.options)
+
+			if !slices.Equal(result.Issues, tt.want) {
+				t.Errorf("issues = %v, want %v", result.Issues, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTDecodeResultSignatureValid(t *testing.T) {
+	token := signTestToken(t, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-time.Minute).Unix()}, "secret")
+
+	// An expired token still has a valid signature.
+	result := JWTDecodeToken(token, JWTDecodeOptions{Secret: "secret"})
+	if !result.IsSignatureValid() || result.Valid() {
+		t.Errorf("signature valid %v, valid %v, want true, false", result.IsSignatureValid(), result.Valid())
+	}
+	if got := result.TokenIssues(); !slices.Equal(got, []JWTIssue{IssueExpired}) {
+		t.Errorf("TokenIssues() = %v, want [%s]", got, IssueExpired)
+	}
+	if got := result.SignatureAlgorithm(); got != "HS256" {
+		t.Errorf("SignatureAlgorithm() = %q, want HS256", got)
+	}
+
+	// A disallowed alg is refused before the signature is checked.
+	result = JWTDecodeToken(token, JWTDecodeOptions{Secret: "secret", AllowedAlgorithms: []string{"RS256"}})
+	if result.IsSignatureValid() || !errors.Is(result.Error, ErrAlgNotAllowed) {
+		t.Errorf("disallowed alg: signature valid %v, error %v, want false, %v", result.IsSignatureValid(), result.Error, ErrAlgNotAllowed)
+	}
+}
+
+func TestJWTEncodeDecodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		alg  string
+		kind KeyKind
+	}{
+		{"HS256", KeyKindHMAC},
+		{"HS512", KeyKindHMAC},
+		{"RS256", KeyKindRSA2048},
+		{"RS512", KeyKindRSA2048},
+		{"PS256", KeyKindRSA2048},
+		{"PS384", KeyKindRSA2048},
+		{"PS512", KeyKindRSA2048},
+		{"ES256", KeyKindECP256},
+		{"ES384", KeyKindECP384},
+		{"ES512", KeyKindECP521},
+		{"EdDSA", KeyKindEd25519},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			key := testKey(t, tt.kind)
+			encoded := JWTEncodeToken(map[string]interface{}{"alg": tt.alg, "typ": "JWT"}, jwt.MapClaims{"sub": "alice"}, key.SigningKey(), "")
+			if encoded.Token == "" {
+				t.Fatalf("JWTEncodeToken: %+v", encoded)
+			}
+
+			result := JWTDecodeToken(encoded.Token, JWTDecodeOptions{Secret: key.VerificationKey(KeyFormatPEM)})
+			if !result.Valid() || result.Algorithm != tt.alg {
+				t.Errorf("%s token: algorithm %s, issues %v, key error %v", tt.alg, result.Algorithm, result.Issues, result.KeyError)
+			}
+		})
+	}
+}
+
+func TestJWTEncodeTokenHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      map[string]interface{}
+		typ         string
+		headerError string
+	}{
+		{"typ defaults to JWT", map[string]interface{}{"alg": "HS256"}, "JWT", ""},
+		{"typ kept", map[string]interface{}{"alg": "HS256", "typ": "at+jwt"}, "at+jwt", ""},
+		{"alg defaults to HS256", map[string]interface{}{}, "JWT", ""},
+		{"unknown alg", map[string]interface{}{"alg": "HS265"}, "", "Unsupported alg HS265"},
+		{"alg none", map[string]interface{}{"alg": "none"}, "", "Unsupported alg none"},
+		{"alg not a string", map[string]interface{}{"alg": 256}, "", "Unsupported alg 256"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := JWTEncodeToken(tt.header, jwt.MapClaims{"sub": "alice"}, "my-secret", "")
+			if encoded.HeaderError != tt.headerError {
+				t.Fatalf("header error = %q, want %q", encoded.HeaderError, tt.headerError)
+			}
+			if tt.headerError != "" {
+				if encoded.Token != "" {
+					t.Errorf("token = %q, want none", encoded.Token)
+				}
+				return
+			}
+
+			result := JWTDecodeToken(encoded.Token, JWTDecodeOptions{Secret: "my-secret"})
+			if !result.Valid() || result.Algorithm != "HS256" {
+				t.Fatalf("algorithm %s, issues %v", result.Algorithm, result.Issues)
+			}
+			if typ := result.Token.Header["typ"]; typ != tt.typ {
+				t.Errorf("typ = %v, want %s", typ, tt.typ)
+			}
+		})
+	}
+}
+
+func TestJWTDecodeTokenPSSIsNotPKCS1(t *testing.T) {
+	key := testKey(t, KeyKindRSA2048)
+	encoded := JWTEncodeToken(map[string]interface{}{"alg": "PS256"}, jwt.MapClaims{"sub": "alice"}, key.PrivatePEM, "")
+
+	// The same key and hash with PKCS #1 v1.5 padding must not verify.
+	parts := strings.Split(encoded.Token, ".")
+	parts[0] = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	relabelled := strings.Join(parts, ".")
+
+	result := JWTDecodeToken(relabelled, JWTDecodeOptions{Secret: key.PublicPEM})
+	if !slices.Equal(result.Issues, []JWTIssue{IssueSignatureInvalid}) {
+		t.Errorf("PS256 signature relabelled RS256: issues %v, want [%s]", result.Issues, IssueSignatureInvalid)
+	}
+}
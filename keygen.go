@@ -0,0 +1,310 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyKind is a kind of key the generator can produce.
+type KeyKind string
+
+const (
+	KeyKindHMAC    KeyKind = "HMAC"
+	KeyKindRSA2048 KeyKind = "RSA-2048"
+	KeyKindRSA3072 KeyKind = "RSA-3072"
+	KeyKindRSA4096 KeyKind = "RSA-4096"
+	KeyKindECP256  KeyKind = "EC-P256"
+	KeyKindECP384  KeyKind = "EC-P384"
+	KeyKindECP521  KeyKind = "EC-P521"
+	KeyKindEd25519 KeyKind = "Ed25519"
+)
+
+// DefaultKeyKind is the kind of key generated unless another is chosen.
+const DefaultKeyKind = KeyKindRSA2048
+
+// KeyKinds lists the kinds of key the generator cycles through.
+var KeyKinds = []KeyKind{
+	KeyKindHMAC,
+	KeyKindRSA2048,
+	KeyKindRSA3072,
+	KeyKindRSA4096,
+	KeyKindECP256,
+	KeyKindECP384,
+	KeyKindECP521,
+	KeyKindEd25519,
+}
+
+// rsaKeyBits is the modulus size of each RSA key kind.
+var rsaKeyBits = map[KeyKind]int{
+	KeyKindRSA2048: 2048,
+	KeyKindRSA3072: 3072,
+	KeyKindRSA4096: 4096,
+}
+
+// keyAlgorithms lists the signing algorithms a key of each kind can be used
+// with, the first is set in its JWKs unless another is chosen. The RSA
+// modulus size does not pick the hash, so every RSA kind defaults to RS256.
+var keyAlgorithms = map[KeyKind][]string{
+	KeyKindHMAC:    {"HS256", "HS384", "HS512"},
+	KeyKindRSA2048: rsaKeyAlgorithms,
+	KeyKindRSA3072: rsaKeyAlgorithms,
+	KeyKindRSA4096: rsaKeyAlgorithms,
+	KeyKindECP256:  {"ES256"},
+	KeyKindECP384:  {"ES384"},
+	KeyKindECP521:  {"ES512"},
+	KeyKindEd25519: {"EdDSA"},
+}
+
+var rsaKeyAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}
+
+// DefaultHMACLength is the length of generated HMAC secrets, long enough for
+// HS512.
+const DefaultHMACLength = 64
+
+// Output formats of generated keys.
+const (
+	KeyFormatPEM = "PEM"
+	KeyFormatJWK = "JWK"
+)
+
+// GeneratedKey is a freshly generated key pair or HMAC secret in every
+// format jwtx reads.
+type GeneratedKey struct {
+	Kind      KeyKind `json:"kind"`
+	Algorithm string  `json:"algorithm"`
+	// KeyID is the RFC 7638 thumbprint of the key, set as kid in its JWKs.
+	KeyID string `json:"kid"`
+	// Secret is the HMAC secret, HMAC keys have no PEM form.
+	Secret     string          `json:"secret,omitempty"`
+	PrivatePEM string          `json:"private_pem,omitempty"`
+	PublicPEM  string          `json:"public_pem,omitempty"`
+	PrivateJWK json.RawMessage `json:"private_jwk"`
+	// JWKS holds the public key, or the secret of an HMAC key.
+	JWKS json.RawMessage `json:"jwks"`
+}
+
+// ParseKeyKind finds a key kind by name, ignoring case.
+func ParseKeyKind(name string) (KeyKind, error) {
+	for _, kind := range KeyKinds {
+		if strings.EqualFold(string(kind), name) {
+			return kind, nil
+		}
+	}
+	return "", fmt.Errorf("unknown key type %q", name)
+}
+
+// KeyAlgorithms returns the algorithms a key of the given kind can sign
+// with. HMAC secrets of hmacLength characters are offered the algorithms
+// they are long enough for, HS256 at least.
+func KeyAlgorithms(kind KeyKind, hmacLength int) []string {
+	if kind != KeyKindHMAC {
+		return keyAlgorithms[kind]
+	}
+
+	algs := []string{jwt.SigningMethodHS256.Alg()}
+	for _, alg := range keyAlgorithms[KeyKindHMAC][1:] {
+		if hmacLength >= hmacMinKeySizes[alg] {
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// CheckKeyAlgorithm returns an error unless a key of the given kind can sign
+// with alg.
+func CheckKeyAlgorithm(kind KeyKind, hmacLength int, alg string) error {
+	algs := KeyAlgorithms(kind, hmacLength)
+	if slices.Contains(algs, alg) {
+		return nil
+	}
+	return fmt.Errorf("%s key cannot sign %s, use one of %s", kind, alg, strings.Join(algs, ", "))
+}
+
+// nextKeyKind returns the key kind after kind.
+func nextKeyKind(kind KeyKind) KeyKind {
+	i := slices.Index(KeyKinds, kind)
+	return KeyKinds[(i+1)%len(KeyKinds)]
+}
+
+// GenerateKey generates a key of the given kind. HMAC secrets are hmacLength
+// characters of the base64url alphabet, so they can be typed and pasted.
+func GenerateKey(kind KeyKind, hmacLength int) (*GeneratedKey, error) {
+	var private crypto.Signer
+	var alg string
+	var err error
+
+	switch kind {
+	case KeyKindHMAC:
+		return generateHMACKey(hmacLength)
+	case KeyKindRSA2048, KeyKindRSA3072, KeyKindRSA4096:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits[kind])
+		alg = jwt.SigningMethodRS256.Alg()
+	case KeyKindECP256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		alg = jwt.SigningMethodES256.Alg()
+	case KeyKindECP384:
+		private, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		alg = jwt.SigningMethodES384.Alg()
+	case KeyKindECP521:
+		private, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+		alg = jwt.SigningMethodES512.Alg()
+	case KeyKindEd25519:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+		alg = jwt.SigningMethodEdDSA.Alg()
+	default:
+		return nil, fmt.Errorf("unknown key type %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	jwk := jose.JSONWebKey{Key: private, Algorithm: alg, Use: "sig"}
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	key := &GeneratedKey{
+		Kind:       kind,
+		Algorithm:  alg,
+		KeyID:      jwk.KeyID,
+		PrivatePEM: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		PublicPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}
+	if key.PrivateJWK, key.JWKS, err = marshalGeneratedJWKs(jwk, jwk.Public()); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// generateHMACKey generates a secret of length characters, signing with the
+// strongest HMAC algorithm the length is enough for, i.e. HS512 from 64
+// characters.
+func generateHMACKey(length int) (*GeneratedKey, error) {
+	if length < 1 {
+		return nil, fmt.Errorf("secret length must be at least 1, got %d", length)
+	}
+
+	random := make([]byte, (length*3+3)/4)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(random)[:length]
+
+	algs := KeyAlgorithms(KeyKindHMAC, length)
+	alg := algs[len(algs)-1]
+
+	// go-jose has no thumbprint for symmetric keys, RFC 7638 section 3.2
+	// takes it over k and kty.
+	k := base64.RawURLEncoding.EncodeToString([]byte(secret))
+	thumbprint := sha256.Sum256([]byte(`{"k":"` + k + `","kty":"oct"}`))
+
+	jwk := jose.JSONWebKey{Key: []byte(secret), KeyID: base64.RawURLEncoding.EncodeToString(thumbprint[:]), Algorithm: alg, Use: "sig"}
+
+	key := &GeneratedKey{Kind: KeyKindHMAC, Algorithm: alg, KeyID: jwk.KeyID, Secret: secret}
+	var err error
+	if key.PrivateJWK, key.JWKS, err = marshalGeneratedJWKs(jwk, jwk); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// marshalGeneratedJWKs formats the private JWK and the set holding the
+// public one.
+func marshalGeneratedJWKs(private, public jose.JSONWebKey) (json.RawMessage, json.RawMessage, error) {
+	privateJSON, err := json.MarshalIndent(private, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	setJSON, err := json.MarshalIndent(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{public}}, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return privateJSON, setJSON, nil
+}
+
+// WithAlgorithm returns the key with alg set in its JWKs instead. The kid
+// stays the same, the thumbprint does not cover alg.
+func (k *GeneratedKey) WithAlgorithm(alg string) (*GeneratedKey, error) {
+	if err := CheckKeyAlgorithm(k.Kind, len(k.Secret), alg); err != nil {
+		return nil, err
+	}
+
+	var jwk jose.JSONWebKey
+	if err := jwk.UnmarshalJSON(k.PrivateJWK); err != nil {
+		return nil, err
+	}
+	jwk.Algorithm = alg
+
+	public := jwk
+	if k.Kind != KeyKindHMAC {
+		public = jwk.Public()
+	}
+
+	key := *k
+	key.Algorithm = alg
+	var err error
+	if key.PrivateJWK, key.JWKS, err = marshalGeneratedJWKs(jwk, public); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// SigningKey returns the key as the encoder takes it.
+func (k *GeneratedKey) SigningKey() string {
+	if k.Kind == KeyKindHMAC {
+		return k.Secret
+	}
+	return k.PrivatePEM
+}
+
+// VerificationKey returns the key as the decoder takes it, in the given
+// format.
+func (k *GeneratedKey) VerificationKey(format string) string {
+	switch {
+	case format == KeyFormatJWK:
+		return string(k.JWKS)
+	case k.Kind == KeyKindHMAC:
+		return k.Secret
+	default:
+		return k.PublicPEM
+	}
+}
+
+// PrivateKey returns the private key, or the secret, in the given format.
+func (k *GeneratedKey) PrivateKey(format string) string {
+	if format == KeyFormatJWK {
+		return string(k.PrivateJWK)
+	}
+	return k.SigningKey()
+}
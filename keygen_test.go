@@ -0,0 +1,125 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestGenerateKeySignsAndVerifies(t *testing.T) {
+	tests := []struct {
+		kind KeyKind
+		alg  string
+	}{
+		{KeyKindHMAC, "HS512"},
+		{KeyKindRSA2048, "RS256"},
+		{KeyKindECP256, "ES256"},
+		{KeyKindECP384, "ES384"},
+		{KeyKindECP521, "ES512"},
+		{KeyKindEd25519, "EdDSA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.kind), func(t *testing.T) {
+			key := testKey(t, tt.kind)
+			if key.Algorithm != tt.alg {
+				t.Errorf("algorithm = %s, want %s", key.Algorithm, tt.alg)
+			}
+
+			token := signTestTokenWithKey(t, key, key.KeyID)
+			for _, format := range []string{KeyFormatPEM, KeyFormatJWK} {
+				result := JWTDecodeToken(token, JWTDecodeOptions{Secret: key.VerificationKey(format)})
+				if !result.Valid() {
+					t.Errorf("%s verification key: issues %v, key error %v", format, result.Issues, result.KeyError)
+				}
+			}
+
+			set := testKeySet(t, key)
+			if got := set.Keys[0].Algorithm; got != tt.alg {
+				t.Errorf("JWK alg = %s, want %s", got, tt.alg)
+			}
+			if got := set.Keys[0].KeyID; got != key.KeyID {
+				t.Errorf("JWK kid = %s, want %s", got, key.KeyID)
+			}
+			if tt.kind != KeyKindHMAC && !set.Keys[0].IsPublic() {
+				t.Error("JWK Set holds the private key")
+			}
+		})
+	}
+}
+
+func TestKeyAlgorithms(t *testing.T) {
+	tests := []struct {
+		kind   KeyKind
+		length int
+		want   []string
+	}{
+		{KeyKindHMAC, 16, []string{"HS256"}},
+		{KeyKindHMAC, 48, []string{"HS256", "HS384"}},
+		{KeyKindHMAC, DefaultHMACLength, []string{"HS256", "HS384", "HS512"}},
+		{KeyKindRSA4096, 0, []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}},
+		{KeyKindECP384, 0, []string{"ES384"}},
+	}
+
+	for _, tt := range tests {
+		if got := KeyAlgorithms(tt.kind, tt.length); !slices.Equal(got, tt.want) {
+			t.Errorf("KeyAlgorithms(%s, %d) = %v, want %v", tt.kind, tt.length, got, tt.want)
+		}
+	}
+}
+
+func TestGeneratedKeyWithAlgorithm(t *testing.T) {
+	key := testKey(t, KeyKindRSA2048)
+
+	ps512, err := key.WithAlgorithm("PS512")
+	if err != nil {
+		t.Fatalf("WithAlgorithm(PS512): %v", err)
+	}
+	if key.Algorithm != "RS256" {
+		t.Errorf("WithAlgorithm changed the original key to %s", key.Algorithm)
+	}
+	if ps512.KeyID != key.KeyID {
+		t.Errorf("kid = %s, want %s", ps512.KeyID, key.KeyID)
+	}
+	if got := testKeySet(t, ps512).Keys[0].Algorithm; got != "PS512" {
+		t.Errorf("JWK alg = %s, want PS512", got)
+	}
+
+	// The JWK Set now only verifies PS512 tokens.
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "alice"}).SignedString(mustParseSigningKey(t, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := JWTDecodeToken(token, JWTDecodeOptions{Secret: string(ps512.JWKS)}); result.IsSignatureValid() {
+		t.Error("PS512 JWK verified an RS256 token")
+	}
+	if result := JWTDecodeToken(signTestTokenWithKey(t, ps512, ""), JWTDecodeOptions{Secret: string(ps512.JWKS)}); !result.Valid() {
+		t.Errorf("PS512 token: issues %v, key error %v", result.Issues, result.KeyError)
+	}
+
+	if _, err := key.WithAlgorithm("ES256"); err == nil {
+		t.Error("WithAlgorithm(ES256) succeeded for an RSA key")
+	}
+
+	short, err := GenerateKey(KeyKindHMAC, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if short.Algorithm != "HS256" {
+		t.Errorf("32 character secret algorithm = %s, want HS256", short.Algorithm)
+	}
+	if _, err := short.WithAlgorithm("HS512"); err == nil {
+		t.Error("WithAlgorithm(HS512) succeeded for a 32 character secret")
+	}
+}
+
+func mustParseSigningKey(t *testing.T, key *GeneratedKey) any {
+	t.Helper()
+
+	signingKey, err := ParseSigningKey(jwt.GetSigningMethod(key.Algorithm), key.SigningKey(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingKey
+}
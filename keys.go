@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/pbkdf2"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrPassphraseRequired  = errors.New("private key is encrypted and needs a passphrase")
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+)
+
+// ParseSigningKey converts the secret entered in the encoder into the key
+// type expected by the signing method. The passphrase is only used when the
+// secret is an encrypted PEM private key.
+func ParseSigningKey(method jwt.SigningMethod, secret, passphrase string) (any, error) {
+	switch m := method.(type) {
+	case *jwt.SigningMethodECDSA:
+		key, err := ParsePrivateKeyFromPEM([]byte(secret), passphrase)
+		if errors.Is(err, ErrPassphraseRequired) || errors.Is(err, ErrIncorrectPassphrase) {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("%s requires a PEM encoded EC private key: %w", m.Alg(), err)
+		}
+
+		ecKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s requires an EC private key, got %s", m.Alg(), KeyTypeName(key))
+		}
+
+		if ecKey.Curve.Params().BitSize != m.CurveBits {
+			return nil, fmt.Errorf("%s requires a P-%d key, got %s", m.Alg(), m.CurveBits, ecKey.Curve.Params().Name)
+		}
+
+		return ecKey, nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		key, err := ParsePrivateKeyFromPEM([]byte(secret), passphrase)
+		if errors.Is(err, ErrPassphraseRequired) || errors.Is(err, ErrIncorrectPassphrase) {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("%s requires a PEM encoded RSA private key: %w", method.Alg(), err)
+		}
+
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s requires an RSA private key, got %s", method.Alg(), KeyTypeName(key))
+		}
+
+		return rsaKey, nil
+	case *jwt.SigningMethodEd25519:
+		key, err := ParseEd25519PrivateKey(secret, passphrase)
+		if errors.Is(err, ErrPassphraseRequired) || errors.Is(err, ErrIncorrectPassphrase) {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("%s requires an Ed25519 private key: %w", method.Alg(), err)
+		}
+
+		return key, nil
+	default:
+		return []byte(secret), nil
+	}
+}
+
+// KeyTypeName returns a human readable name for a parsed key, used in
+// status messages.
+func KeyTypeName(key any) string {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return "an RSA private key"
+	case *rsa.PublicKey:
+		return "an RSA public key"
+	case *ecdsa.PrivateKey:
+		return "an EC private key"
+	case *ecdsa.PublicKey:
+		return "an EC public key"
+	case ed25519.PrivateKey:
+		return "an Ed25519 private key"
+	case ed25519.PublicKey:
+		return "an Ed25519 public key"
+	case []byte:
+		return "an HMAC secret"
+	default:
+		return fmt.Sprintf("a %T key", key)
+	}
+}
+
+// ResolveVerificationKey converts the secret entered in the decoder into the
+// key type required by the token's signing method, explaining any mismatch
+// between the two.
+func ResolveVerificationKey(method jwt.SigningMethod, secret string) (any, error) {
+	alg := method.Alg()
+
+	if block, _ := pem.Decode([]byte(secret)); block != nil {
+		key, err := ParseVerificationKeyFromPEM([]byte(secret))
+		if err != nil {
+			return nil, fmt.Errorf("%s token but the PEM key could not be parsed: %w", alg, err)
+		}
+		return MatchVerificationKey(method, key)
+	}
+
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if secret == "" {
+			return nil, fmt.Errorf("%s token but no secret was supplied", alg)
+		}
+		return []byte(secret), nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS, *jwt.SigningMethodECDSA:
+		return nil, fmt.Errorf("%s token but an HMAC secret was supplied", alg)
+	case *jwt.SigningMethodEd25519:
+		edKey, err := ParseEd25519PublicKey(secret)
+		if err != nil {
+			return nil, fmt.Errorf("%s token but an HMAC secret was supplied", alg)
+		}
+		return edKey, nil
+	default:
+		return nil, fmt.Errorf("%s tokens cannot be verified", alg)
+	}
+}
+
+// MatchVerificationKey checks that an already parsed key can verify tokens
+// signed with the given method.
+func MatchVerificationKey(method jwt.SigningMethod, key any) (any, error) {
+	alg := method.Alg()
+
+	switch m := method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if secret, ok := key.([]byte); ok {
+			return secret, nil
+		}
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+	case *jwt.SigningMethodECDSA:
+		if ecKey, ok := key.(*ecdsa.PublicKey); ok {
+			if ecKey.Curve.Params().BitSize != m.CurveBits {
+				return nil, fmt.Errorf("%s token but a %s key was supplied", alg, ecKey.Curve.Params().Name)
+			}
+			return ecKey, nil
+		}
+	case *jwt.SigningMethodEd25519:
+		if edKey, ok := key.(ed25519.PublicKey); ok {
+			return edKey, nil
+		}
+	default:
+		return nil, fmt.Errorf("%s tokens cannot be verified", alg)
+	}
+
+	return nil, fmt.Errorf("%s token but %s was supplied", alg, KeyTypeName(key))
+}
+
+// ParseVerificationKeyFromPEM parses a public key, certificate or private
+// key from PEM, returning the public half in every case.
+func ParseVerificationKeyFromPEM(pemBytes []byte) (crypto.PublicKey, error) {
+	if key, err := ParsePublicKeyFromPEM(pemBytes); err == nil {
+		return key, nil
+	}
+
+	key, err := ParsePrivateKeyFromPEM(pemBytes, "")
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key %T", key)
+	}
+
+	return signer.Public(), nil
+}
+
+// ParsePublicKeyFromPEM parses a PKIX or PKCS#1 public key, or the public
+// key of an X.509 certificate.
+func ParsePublicKeyFromPEM(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse PEM block containing public key")
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
+
+// ParseEd25519PrivateKey parses an Ed25519 private key given either as PEM
+// or as a base64 or hex encoded 32 byte seed or 64 byte private key.
+func ParseEd25519PrivateKey(secret, passphrase string) (ed25519.PrivateKey, error) {
+	if block, _ := pem.Decode([]byte(secret)); block != nil {
+		key, err := ParsePrivateKeyFromPEM([]byte(secret), passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("got %s", KeyTypeName(key))
+		}
+		return edKey, nil
+	}
+
+	raw, err := decodeRawKey(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		// The second half is the public key, a mismatch would sign with
+		// one key and publish another.
+		key := ed25519.NewKeyFromSeed(raw[:ed25519.SeedSize])
+		if !bytes.Equal(key, raw) {
+			return nil, errors.New("raw key's last 32 bytes are not the public key of its seed")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("raw key must be %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+	}
+}
+
+// ParseEd25519PublicKey parses an Ed25519 public key given either as PEM or
+// as a base64 or hex encoded 32 byte key.
+func ParseEd25519PublicKey(secret string) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode([]byte(secret)); block != nil {
+		key, err := ParsePublicKeyFromPEM([]byte(secret))
+		if err != nil {
+			return nil, err
+		}
+
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("got %s", KeyTypeName(key))
+		}
+		return edKey, nil
+	}
+
+	raw, err := decodeRawKey(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("raw key must be %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+	}
+
+	return ed25519.PublicKey(raw), nil
+}
+
+// decodeRawKey decodes key bytes written as hex or as standard or URL-safe
+// base64, with or without padding.
+func decodeRawKey(secret string) ([]byte, error) {
+	secret = strings.TrimSpace(secret)
+
+	if raw, err := hex.DecodeString(secret); err == nil {
+		return raw, nil
+	}
+
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if raw, err := encoding.DecodeString(secret); err == nil {
+			return raw, nil
+		}
+	}
+
+	return nil, errors.New("key is neither PEM, hex nor base64 encoded")
+}
+
+// IsEncryptedPrivateKeyPEM reports whether the secret is a PEM private key
+// that needs a passphrase before it can be used.
+func IsEncryptedPrivateKeyPEM(secret string) bool {
+	block, _ := pem.Decode([]byte(secret))
+	if block == nil {
+		return false
+	}
+
+	return block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block)
+}
+
+// ParsePrivateKeyFromPEM parses a PKCS#1, PKCS#8 or SEC 1 private key,
+// decrypting it first when it is a legacy encrypted PEM block or a PKCS#8
+// EncryptedPrivateKeyInfo.
+func ParsePrivateKeyFromPEM(pemBytes []byte, passphrase string) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, jwt.ErrKeyMustBePEMEncoded
+	}
+
+	der := block.Bytes
+
+	if x509.IsEncryptedPEMBlock(block) {
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+
+		decrypted, err := x509.DecryptPEMBlock(block, []byte(passphrase))
+		if err != nil {
+			return nil, ErrIncorrectPassphrase
+		}
+		der = decrypted
+	} else if block.Type == "ENCRYPTED PRIVATE KEY" {
+		if passphrase == "" {
+			return nil, ErrPassphraseRequired
+		}
+
+		decrypted, err := decryptPKCS8(der, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		der = decrypted
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported private key in %q PEM block", block.Type)
+}
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3   = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// maxPBKDF2Iterations bounds the iteration count read from a key file, which
+// would otherwise let a crafted key keep jwtx busy indefinitely. OpenSSL
+// defaults to 2048, password managers stay well below a million.
+const maxPBKDF2Iterations = 10_000_000
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts a PBES2 protected PKCS#8 EncryptedPrivateKeyInfo,
+// which is what `openssl genpkey -aes256` and `openssl pkcs8 -topk8` produce.
+func decryptPKCS8(der []byte, passphrase string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %w", err)
+	}
+
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported key encryption algorithm %s", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid PBES2 parameters: %w", err)
+	}
+
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("invalid PBKDF2 parameters: %w", err)
+	}
+	if kdf.IterationCount <= 0 || kdf.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("unsupported PBKDF2 iteration count %d", kdf.IterationCount)
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 PRF %s", kdf.PRF.Algorithm)
+	}
+
+	var keyLen int
+	var newCipher func([]byte) (cipher.Block, error)
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLen, newCipher = 16, aes.NewCipher
+	case scheme.Equal(oidAES192CBC):
+		keyLen, newCipher = 24, aes.NewCipher
+	case scheme.Equal(oidAES256CBC):
+		keyLen, newCipher = 32, aes.NewCipher
+	case scheme.Equal(oidDESEDE3):
+		keyLen, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, fmt.Errorf("unsupported key encryption scheme %s", scheme)
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("invalid encryption IV: %w", err)
+	}
+
+	key, err := pbkdf2.Key(prf, passphrase, kdf.Salt, kdf.IterationCount, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := info.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid encrypted private key length")
+	}
+
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	// A wrong passphrase almost always surfaces as broken PKCS#7 padding.
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, ErrIncorrectPassphrase
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, ErrIncorrectPassphrase
+		}
+	}
+
+	return plain[:len(plain)-padding], nil
+}
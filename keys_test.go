@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// The PKCS#8 fixtures in testdata/pkcs8 encrypt plain.pem with this
+// passphrase, e.g. `openssl pkcs8 -topk8 -in plain.pem -v2 aes-256-cbc`.
+const testPassphrase = "correct-horse"
+
+func readPEMFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/pkcs8/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("%s holds no PEM block", name)
+	}
+	return block.Bytes
+}
+
+// reencryptPKCS8 decrypts the aes-256-cbc, hmacWithSHA256 fixture and
+// encrypts the plaintext changed by edit again, so the padding can be
+// broken on purpose.
+func reencryptPKCS8(t *testing.T, edit func(plain []byte) []byte) []byte {
+	t.Helper()
+
+	var info encryptedPrivateKeyInfo
+	var params pbes2Params
+	var kdf pbkdf2Params
+	var iv []byte
+	unmarshal := func(der []byte, v any) {
+		if _, err := asn1.Unmarshal(der, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unmarshal(readPEMFixture(t, "aes256.pem"), &info)
+	unmarshal(info.Algorithm.Parameters.FullBytes, &params)
+	unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf)
+	unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv)
+
+	key, err := pbkdf2.Key(sha256.New, testPassphrase, kdf.Salt, kdf.IterationCount, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, info.EncryptedData)
+	plain = edit(plain)
+
+	info.EncryptedData = plain
+	if len(plain)%block.BlockSize() == 0 {
+		info.EncryptedData = make([]byte, len(plain))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(info.EncryptedData, plain)
+	}
+
+	der, err := asn1.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// setIterations rewrites the PBKDF2 iteration count of the aes-256-cbc
+// fixture, leaving the encrypted data as it is.
+func setIterations(t *testing.T, count int) []byte {
+	t.Helper()
+
+	var info encryptedPrivateKeyInfo
+	var params pbes2Params
+	var kdf pbkdf2Params
+	unmarshal := func(der []byte, v any) {
+		if _, err := asn1.Unmarshal(der, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	marshal := func(v any) asn1.RawValue {
+		der, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return asn1.RawValue{FullBytes: der}
+	}
+	unmarshal(readPEMFixture(t, "aes256.pem"), &info)
+	unmarshal(info.Algorithm.Parameters.FullBytes, &params)
+	unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf)
+
+	kdf.IterationCount = count
+	params.KeyDerivationFunc.Parameters = marshal(kdf)
+	info.Algorithm.Parameters = marshal(params)
+	return marshal(info).FullBytes
+}
+
+// setPadding replaces the PKCS#7 padding of a plaintext with the given bytes.
+func setPadding(padding ...byte) func([]byte) []byte {
+	return func(plain []byte) []byte {
+		plain = bytes.Clone(plain)
+		copy(plain[len(plain)-len(padding):], padding)
+		return plain
+	}
+}
+
+func TestDecryptPKCS8(t *testing.T) {
+	plain := readPEMFixture(t, "plain.pem")
+
+	tests := []struct {
+		name       string
+		der        []byte
+		passphrase string
+		err        error
+		message    string
+	}{
+		{name: "aes-256-cbc", der: readPEMFixture(t, "aes256.pem"), passphrase: testPassphrase},
+		{name: "aes-128-cbc hmacWithSHA1", der: readPEMFixture(t, "aes128-sha1.pem"), passphrase: testPassphrase},
+		{name: "des3 hmacWithSHA512", der: readPEMFixture(t, "des3-sha512.pem"), passphrase: testPassphrase},
+		{name: "wrong passphrase", der: readPEMFixture(t, "aes256.pem"), passphrase: "battery-staple", err: ErrIncorrectPassphrase},
+		{name: "zero padding", der: reencryptPKCS8(t, setPadding(0)), passphrase: testPassphrase, err: ErrIncorrectPassphrase},
+		{name: "padding longer than a block", der: reencryptPKCS8(t, setPadding(17)), passphrase: testPassphrase, err: ErrIncorrectPassphrase},
+		{name: "inconsistent padding", der: reencryptPKCS8(t, setPadding(1, 3, 3)), passphrase: testPassphrase, err: ErrIncorrectPassphrase},
+		{
+			name:       "partial block",
+			der:        reencryptPKCS8(t, func(plain []byte) []byte { return plain[:len(plain)-1] }),
+			passphrase: testPassphrase,
+			message:    "invalid encrypted private key length",
+		},
+		{name: "unsupported PRF", der: readPEMFixture(t, "sha224.pem"), passphrase: testPassphrase, message: "unsupported PBKDF2 PRF"},
+		{name: "unsupported cipher", der: readPEMFixture(t, "camellia.pem"), passphrase: testPassphrase, message: "unsupported key encryption scheme"},
+		{name: "scrypt", der: readPEMFixture(t, "scrypt.pem"), passphrase: testPassphrase, message: "unsupported key derivation function"},
+		{name: "PBES1", der: readPEMFixture(t, "pbes1.pem"), passphrase: testPassphrase, message: "unsupported key encryption algorithm"},
+		{name: "zero iterations", der: setIterations(t, 0), passphrase: testPassphrase, message: "unsupported PBKDF2 iteration count 0"},
+		{name: "negative iterations", der: setIterations(t, -1), passphrase: testPassphrase, message: "unsupported PBKDF2 iteration count -1"},
+		{name: "excessive iterations", der: setIterations(t, 1<<31-1), passphrase: testPassphrase, message: "unsupported PBKDF2 iteration count"},
+		{name: "not DER", der: []byte("not a key"), passphrase: testPassphrase, message: "invalid encrypted private key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decryptPKCS8(tt.der, tt.passphrase)
+
+			switch {
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Errorf("error = %v, want %v", err, tt.err)
+				}
+			case tt.message != "":
+				if err == nil || !strings.Contains(err.Error(), tt.message) {
+					t.Errorf("error = %v, want it to contain %q", err, tt.message)
+				}
+			case err != nil:
+				t.Errorf("error = %v", err)
+			case !bytes.Equal(got, plain):
+				t.Error("decrypted key differs from plain.pem")
+			}
+		})
+	}
+}
+
+func TestParsePrivateKeyFromPEMPassphrase(t *testing.T) {
+	encrypted, err := os.ReadFile("testdata/pkcs8/aes256.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParsePrivateKeyFromPEM(encrypted, ""); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("without a passphrase: error = %v, want %v", err, ErrPassphraseRequired)
+	}
+
+	if _, err := ParsePrivateKeyFromPEM(encrypted, "battery-staple"); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("wrong passphrase: error = %v, want %v", err, ErrIncorrectPassphrase)
+	}
+
+	if _, err := ParsePrivateKeyFromPEM(encrypted, testPassphrase); err != nil {
+		t.Errorf("correct passphrase: error = %v", err)
+	}
+}
+
+func TestParseEd25519PrivateKey(t *testing.T) {
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	key := ed25519.NewKeyFromSeed(seed)
+
+	mismatched := bytes.Clone(key)
+	copy(mismatched[ed25519.SeedSize:], ed25519.NewKeyFromSeed(bytes.Repeat([]byte{8}, ed25519.SeedSize)).Public().(ed25519.PublicKey))
+
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr bool
+	}{
+		{"hex seed", hex.EncodeToString(seed), false},
+		{"base64 seed", base64.StdEncoding.EncodeToString(seed), false},
+		{"hex private key", hex.EncodeToString(key), false},
+		{"base64url private key", base64.RawURLEncoding.EncodeToString(key), false},
+		{"mismatched public half", hex.EncodeToString(mismatched), true},
+		{"wrong length", hex.EncodeToString(seed[:16]), true},
+		{"not encoded", "not a key!", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEd25519PrivateKey(tt.secret, "")
+			if tt.wantErr {
+				if err == nil {
+					t.Error("ParseEd25519PrivateKey succeeded")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseEd25519PrivateKey: %v", err)
+			}
+			if !got.Equal(key) {
+				t.Error("parsed key differs from the seed's key")
+			}
+		})
+	}
+}
+
+func TestResolveVerificationKey(t *testing.T) {
+	rsaKey := testKey(t, KeyKindRSA2048)
+	p256 := testKey(t, KeyKindECP256)
+	p384 := testKey(t, KeyKindECP384)
+	ed := testKey(t, KeyKindEd25519)
+
+	tests := []struct {
+		name    string
+		alg     string
+		secret  string
+		want    string
+		message string
+	}{
+		{name: "HMAC secret", alg: "HS256", secret: "secret", want: "an HMAC secret"},
+		{name: "RSA public key", alg: "RS256", secret: rsaKey.PublicPEM, want: "an RSA public key"},
+		{name: "RSA private key", alg: "PS384", secret: rsaKey.PrivatePEM, want: "an RSA public key"},
+		{name: "EC public key", alg: "ES256", secret: p256.PublicPEM, want: "an EC public key"},
+		{name: "Ed25519 public key", alg: "EdDSA", secret: ed.PublicPEM, want: "an Ed25519 public key"},
+		// A public key is never used as an HMAC secret.
+		{name: "key confusion", alg: "HS256", secret: rsaKey.PublicPEM, message: "HS256 token but an RSA public key was supplied"},
+		{name: "HMAC secret for RSA", alg: "RS256", secret: "secret", message: "RS256 token but an HMAC secret was supplied"},
+		{name: "HMAC secret for EdDSA", alg: "EdDSA", secret: "secret", message: "EdDSA token but an HMAC secret was supplied"},
+		{name: "wrong curve", alg: "ES256", secret: p384.PublicPEM, message: "ES256 token but a P-384 key was supplied"},
+		{name: "EC key for RSA", alg: "RS256", secret: p256.PublicPEM, message: "RS256 token but an EC public key was supplied"},
+		{name: "no secret", alg: "HS256", secret: "", message: "no secret was supplied"},
+		{name: "broken PEM", alg: "RS256", secret: "-----BEGIN PUBLIC KEY-----\nAAAA\n-----END PUBLIC KEY-----\n", message: "PEM key could not be parsed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ResolveVerificationKey(jwt.GetSigningMethod(tt.alg), tt.secret)
+
+			if tt.message != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.message) {
+					t.Errorf("error = %v, want it to contain %q", err, tt.message)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveVerificationKey: %v", err)
+			}
+			if got := KeyTypeName(key); got != tt.want {
+				t.Errorf("key = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
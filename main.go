@@ -1,17 +1,192 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
 	tea "charm.land/bubbletea/v2"
 	zone "github.com/lrstanley/bubblezone/v2"
 )
 
+// EnvSecret names the environment variable used to pre-fill the decoder secret.
+const EnvSecret = "JWTX_SECRET"
+
 func main() {
 	// ctx := context.Background()
 
+	if len(os.Args) > 1 {
+		if command, ok := Commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		}
+	}
+
+	os.Exit(runTUI(os.Args[1:], os.Stdin, os.Stderr))
+}
+
+// runTUI starts the interactive program, pre-filling the decoder from the
+// token argument or stdin and the secret from --secret-file or JWTX_SECRET.
+func runTUI(args []string, stdin *os.File, stderr io.Writer) int {
+	inputs, code := resolveTUIInputs(args, os.Getenv(EnvSecret), stdin, !isTerminal(stdin), stderr)
+	if inputs == nil {
+		return code
+	}
+
+	var programOptions []tea.ProgramOption
+
+	if inputs.TokenFromStdin {
+		// stdin is the pipe we just drained, read keys from the terminal instead.
+		ttyIn, _, err := tea.OpenTTY()
+		if err != nil {
+			fmt.Fprintf(stderr, "jwtx: opening terminal: %v\n", err)
+			return ExitUsage
+		}
+		defer ttyIn.Close()
+
+		programOptions = append(programOptions, tea.WithInput(ttyIn))
+	}
+
 	zone.NewGlobal()
 
-	_, err := tea.NewProgram(NewBubbleTeamModel()).Run()
+	_, err := tea.NewProgram(NewBubbleTeamModel(inputs.Options), programOptions...).Run()
 	if err != nil {
 		panic(err)
 	}
+
+	return ExitOK
+}
+
+// tuiInputs are the initial model options resolved from the command line.
+type tuiInputs struct {
+	Options BubbleTeaModelOptions
+	// TokenFromStdin is set when the token was read from piped stdin, keys
+	// then have to be read from the terminal.
+	TokenFromStdin bool
+}
+
+// resolveTUIInputs parses the interactive program flags. secret is the value
+// of JWTX_SECRET, used unless --secret-file or --jwks is given, and the token
+// is read from stdin when piped is set and no token argument is given. It
+// returns nil and the exit code once an error or the usage is written to
+// stderr.
+func resolveTUIInputs(args []string, secret string, stdin io.Reader, piped bool, stderr io.Writer) (*tuiInputs, int) {
+	flags := flag.NewFlagSet("jwtx", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: jwtx [flags] [token]")
+		fmt.Fprintln(stderr, "       jwtx decode [flags] [token]")
+		fmt.Fprintln(stderr, "       jwtx encode [flags]")
+		fmt.Fprintln(stderr, "       jwtx crack --wordlist words.txt [flags] [token]")
+		fmt.Fprintln(stderr, "       jwtx fixtures [--key-file public.pem] [flags] [token]")
+		fmt.Fprintln(stderr, "       jwtx keygen [--type RSA-2048] [flags]")
+		fmt.Fprintln(stderr, "\nStarts the interactive decoder, pre-filled with the token given as an argument or on stdin.")
+		fmt.Fprintf(stderr, "The secret is read from --secret-file or the %s environment variable.\n", EnvSecret)
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+
+	secretFile := flags.String("secret-file", "", "file holding the decoder secret or PEM encoded key")
+	passphrase := flags.String("passphrase", "", "passphrase of an encrypted private key in the decoder secret")
+	jwksFile := flags.String("jwks", "", "file holding a JWK or JWK Set used as the decoder secret")
+	jwksURL := flags.String("jwks-url", "", "URL of a JWK Set used when the decoder secret is empty")
+	oidcIssuer := flags.String("oidc-issuer", "", "OpenID Connect issuer to verify tokens against")
+	audience := flags.String("audience", "", "require aud to contain this value (default --client-id for ID tokens)")
+	idToken := addIDTokenFlags(flags)
+	policy := addPolicyFlags(flags, stdin)
+	schemaFile := flags.String("schema", "", "file holding a JSON Schema the {\"header\": ..., \"claims\": ...} of tokens must match")
+	rulesFile := flags.String("rules", "", "file holding CEL rules over header and claims listed in the decoder checks")
+	timeZone := flags.String("tz", "Local", "time zone of the timestamps shown next to time claims, e.g. UTC or Europe/Berlin")
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, ExitOK
+		}
+		return nil, ExitUsage
+	}
+
+	if flags.Lookup("policy").Value.String() == "-" && flags.NArg() == 0 && piped {
+		fmt.Fprintln(stderr, "jwtx: --policy and the token cannot both read stdin")
+		return nil, ExitUsage
+	}
+
+	loc, err := time.LoadLocation(*timeZone)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: unknown time zone %q\n", *timeZone)
+		return nil, ExitUsage
+	}
+
+	options := BubbleTeaModelOptions{
+		Secret:     secret,
+		Passphrase: *passphrase,
+		Issuer:     *oidcIssuer,
+		Audience:   *audience,
+		IDToken:    idToken(),
+		TimeZone:   loc,
+	}
+
+	validationPolicy, err := policy()
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: --policy: %v\n", err)
+		return nil, ExitUsage
+	}
+	options.Schema, err = readTokenSchema(*schemaFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: --schema: %v\n", err)
+		return nil, ExitUsage
+	}
+
+	options.Rules, err = readRules(*rulesFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "jwtx: --rules: %v\n", err)
+		return nil, ExitUsage
+	}
+
+	if validationPolicy != nil {
+		policyJSON, _ := json.MarshalIndent(validationPolicy, "", "  ")
+		options.Policy = string(policyJSON)
+	}
+
+	if *secretFile != "" || *jwksFile != "" {
+		key, err := readKeyFlags("", *secretFile, *jwksFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "jwtx: %v\n", err)
+			return nil, ExitUsage
+		}
+		options.Secret = key
+	}
+
+	if *jwksURL != "" && *oidcIssuer != "" {
+		fmt.Fprintln(stderr, "jwtx: --jwks-url cannot be combined with --oidc-issuer")
+		return nil, ExitUsage
+	}
+
+	if *jwksURL != "" {
+		options.JWKS = NewRemoteJWKS(*jwksURL, nil)
+	}
+
+	inputs := &tuiInputs{Options: options}
+
+	switch {
+	case flags.NArg() > 1:
+		fmt.Fprintln(stderr, "jwtx: expected a single token argument")
+		return nil, ExitUsage
+	case flags.NArg() == 1:
+		inputs.Options.Token = strings.TrimSpace(flags.Arg(0))
+	case piped:
+		token, err := readTokenArg(nil, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "jwtx: %v\n", err)
+			return nil, ExitUsage
+		}
+		inputs.Options.Token = token
+		inputs.TokenFromStdin = true
+	}
+
+	return inputs, ExitOK
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestResolveTUIInputs(t *testing.T) {
+	secretFile := writeTestFile(t, "secret.txt", "file-secret\n")
+
+	tests := []struct {
+		name           string
+		args           []string
+		env            string
+		stdin          string
+		piped          bool
+		secret         string
+		passphrase     string
+		token          string
+		tokenFromStdin bool
+	}{
+		{
+			name:   "secret from the environment",
+			env:    "env-secret",
+			secret: "env-secret",
+		},
+		{
+			name:   "secret file over the environment",
+			args:   []string{"--secret-file", secretFile},
+			env:    "env-secret",
+			secret: "file-secret",
+		},
+		{
+			name:       "passphrase",
+			args:       []string{"--secret-file", secretFile, "--passphrase", "correct-horse"},
+			secret:     "file-secret",
+			passphrase: "correct-horse",
+		},
+		{
+			name:           "token from stdin",
+			stdin:          "header.claims.signature\n",
+			piped:          true,
+			token:          "header.claims.signature",
+			tokenFromStdin: true,
+		},
+		{
+			name:  "token argument over stdin",
+			args:  []string{"argument.claims.signature"},
+			stdin: "header.claims.signature\n",
+			piped: true,
+			token: "argument.claims.signature",
+		},
+		{
+			name:  "stdin is a terminal",
+			stdin: "header.claims.signature\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+
+			inputs, code := resolveTUIInputs(tt.args, tt.env, strings.NewReader(tt.stdin), tt.piped, &stderr)
+			if inputs == nil {
+				t.Fatalf("exit code = %d (stderr %q)", code, stderr.String())
+			}
+			if inputs.Options.Secret != tt.secret {
+				t.Errorf("secret = %q, want %q", inputs.Options.Secret, tt.secret)
+			}
+			if inputs.Options.Passphrase != tt.passphrase {
+				t.Errorf("passphrase = %q, want %q", inputs.Options.Passphrase, tt.passphrase)
+			}
+			if inputs.Options.Token != tt.token || inputs.TokenFromStdin != tt.tokenFromStdin {
+				t.Errorf("token = %q from stdin %v, want %q from stdin %v", inputs.Options.Token, inputs.TokenFromStdin, tt.token, tt.tokenFromStdin)
+			}
+		})
+	}
+}
+
+func TestResolveTUIInputsUsage(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		stderr string
+	}{
+		{
+			name:   "jwks url and oidc issuer",
+			args:   []string{"--jwks-url", "https://issuer.example/jwks", "--oidc-issuer", "https://issuer.example"},
+			stderr: "--jwks-url cannot be combined with --oidc-issuer",
+		},
+		{
+			name:   "two tokens",
+			args:   []string{"first.claims.signature", "second.claims.signature"},
+			stderr: "expected a single token argument",
+		},
+		{
+			name:   "policy and token from stdin",
+			args:   []string{"--policy", "-"},
+			stderr: "--policy and the token cannot both read stdin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+
+			inputs, code := resolveTUIInputs(tt.args, "", strings.NewReader(""), true, &stderr)
+			if inputs != nil || code != ExitUsage {
+				t.Fatalf("inputs = %+v, exit code = %d, want %d", inputs, code, ExitUsage)
+			}
+			if !strings.Contains(stderr.String(), tt.stderr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// NestedToken is a JWT or JWE found inside another token, such as an
+// original user token carried in a claim or a signed JWT inside a JWE.
+type NestedToken struct {
+	// Path locates the token, e.g. "claims.act.original_token" or "payload"
+	// for the plaintext of a JWE.
+	Path  string `json:"path"`
+	Token string `json:"token"`
+}
+
+// LooksLikeJWT reports whether s is a JWS or JWE compact token, judged by its
+// segment count and a protected header naming an alg (and enc for a JWE).
+func LooksLikeJWT(s string) bool {
+	s = strings.TrimSpace(s)
+
+	segments := strings.Split(s, ".")
+	if len(segments) != 3 && len(segments) != 5 {
+		return false
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(segments[0])
+	if err != nil {
+		return false
+	}
+
+	var header map[string]any
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return false
+	}
+
+	if _, ok := header["alg"].(string); !ok {
+		return false
+	}
+
+	if len(segments) == 5 {
+		_, ok := header["enc"].(string)
+		return ok
+	}
+
+	return true
+}
+
+// FindNestedTokens returns the tokens embedded in the decoded header and
+// claims, and the plaintext of a JWE when it is itself a token.
+func FindNestedTokens(result *JWTDecodeResult) []NestedToken {
+	if result == nil || result.Token == nil {
+		return nil
+	}
+
+	var tokens []NestedToken
+
+	if LooksLikeJWT(string(result.Plaintext)) {
+		tokens = append(tokens, NestedToken{Path: "payload", Token: strings.TrimSpace(string(result.Plaintext))})
+	}
+
+	tokens = appendNestedTokens(tokens, "header", map[string]any(result.Token.Header))
+	if result.Token.Claims != nil {
+		// Round trip through JSON so every claims type walks as plain maps.
+		if raw, err := json.Marshal(result.Token.Claims); err == nil {
+			var claims any
+			if json.Unmarshal(raw, &claims) == nil {
+				tokens = appendNestedTokens(tokens, "claims", claims)
+			}
+		}
+	}
+
+	return tokens
+}
+
+func appendNestedTokens(tokens []NestedToken, path string, value any) []NestedToken {
+	switch v := value.(type) {
+	case string:
+		if LooksLikeJWT(v) {
+			tokens = append(tokens, NestedToken{Path: path, Token: strings.TrimSpace(v)})
+		}
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			tokens = appendNestedTokens(tokens, path+"."+k, v[k])
+		}
+	case []any:
+		for i, item := range v {
+			tokens = appendNestedTokens(tokens, fmt.Sprintf("%s[%d]", path, i), item)
+		}
+	}
+
+	return tokens
+}
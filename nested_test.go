@@ -0,0 +1,81 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestLooksLikeJWT(t *testing.T) {
+	inner := signTestToken(t, jwt.MapClaims{"sub": "alice"}, "secret")
+
+	tests := []struct {
+		name string
+		s    string
+		want bool
+	}{
+		{"JWS", inner, true},
+		{"JWS with whitespace", "\n" + inner + " ", true},
+		{"unsigned", "eyJhbGciOiJub25lIn0.e30.", true},
+		{"JWE", "eyJhbGciOiJkaXIiLCJlbmMiOiJBMjU2R0NNIn0....", true},
+		{"five segments without enc", "eyJhbGciOiJkaXIifQ....", false},
+		{"header without alg", "eyJ0eXAiOiJKV1QifQ.e30.", false},
+		{"dotted name", "www.example.com", false},
+		{"version", "1.2.3", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := LooksLikeJWT(tt.s); got != tt.want {
+			t.Errorf("%s: LooksLikeJWT(%q) = %v, want %v", tt.name, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestFindNestedTokens(t *testing.T) {
+	inner := signTestToken(t, jwt.MapClaims{"sub": "alice"}, "secret")
+	outer := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "service",
+		"act":   map[string]any{"original_token": inner},
+		"chain": []any{"not a token", inner},
+		"host":  "api.example.com",
+	})
+	outer.Header["x-token"] = inner
+	signed, err := outer.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, nested := range FindNestedTokens(JWTDecodeToken(signed, JWTDecodeOptions{Secret: "secret"})) {
+		paths = append(paths, nested.Path)
+		if nested.Token != inner {
+			t.Errorf("%s: token %q, want the inner token", nested.Path, nested.Token)
+		}
+	}
+	if want := []string{"header.x-token", "claims.act.original_token", "claims.chain[1]"}; !slices.Equal(paths, want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+}
+
+func TestFindNestedTokensJWEPayload(t *testing.T) {
+	recipient := testKey(t, KeyKindRSA2048)
+	signer := testKey(t, KeyKindECP256)
+	encrypted := JWTEncryptToken(map[string]interface{}{"alg": "ES256"}, jwt.MapClaims{"sub": "alice"}, signer.PrivatePEM, "", JWEEncryptOptions{
+		KeyAlgorithm:      jose.RSA_OAEP_256,
+		ContentEncryption: jose.A128GCM,
+		RecipientKey:      recipient.PublicPEM,
+		Nested:            true,
+	})
+	if encrypted.Token == "" {
+		t.Fatalf("JWTEncryptToken: %+v", encrypted)
+	}
+	token := encrypted.Token
+
+	nested := FindNestedTokens(JWTDecodeToken(token, JWTDecodeOptions{Secret: recipient.PrivatePEM}))
+	if len(nested) == 0 || nested[0].Path != "payload" || !LooksLikeJWT(nested[0].Token) {
+		t.Errorf("nested tokens = %v, want the signed payload first", nested)
+	}
+}
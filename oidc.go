@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OIDCDiscoveryPath is appended to the issuer to find its provider metadata.
+const OIDCDiscoveryPath = "/.well-known/openid-configuration"
+
+// OIDCProviderMetadata holds the parts of the discovery document used to
+// verify ID tokens.
+type OIDCProviderMetadata struct {
+	Issuer                              string   `json:"issuer"`
+	JWKSURI                             string   `json:"jwks_uri"`
+	IDTokenSigningAlgValuesSupported    []string `json:"id_token_signing_alg_values_supported"`
+	IDTokenEncryptionAlgValuesSupported []string `json:"id_token_encryption_alg_values_supported"`
+	IDTokenEncryptionEncValuesSupported []string `json:"id_token_encryption_enc_values_supported"`
+}
+
+// OIDCProvider is a discovered OpenID Connect provider with its key set.
+type OIDCProvider struct {
+	Metadata OIDCProviderMetadata
+	JWKS     *RemoteJWKS
+}
+
+// DiscoverOIDCProvider reads the issuer's discovery document and prepares a
+// cache for the JWK Set it names. A nil client uses http.DefaultClient.
+func DiscoverOIDCProvider(ctx context.Context, issuer string, client *http.Client) (*OIDCProvider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(issuer, "/")+OIDCDiscoveryPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OIDC discovery: unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+
+	var metadata OIDCProviderMetadata
+	if err := json.Unmarshal(body, &metadata); err != nil {
+		return nil, fmt.Errorf("OIDC discovery: invalid provider metadata: %w", err)
+	}
+
+	// OpenID Connect Discovery 1.0 section 4.3 requires an exact match.
+	if metadata.Issuer != issuer {
+		return nil, fmt.Errorf("OIDC discovery: provider reports issuer %q, expected %q", metadata.Issuer, issuer)
+	}
+
+	if metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery: provider metadata has no jwks_uri")
+	}
+
+	return &OIDCProvider{
+		Metadata: metadata,
+		JWKS:     NewRemoteJWKS(metadata.JWKSURI, client),
+	}, nil
+}
+
+// DecodeOptions fills in the issuer and allowed algorithms the provider
+// advertises, including the ones encrypted ID tokens may use.
+func (p *OIDCProvider) DecodeOptions(options JWTDecodeOptions) JWTDecodeOptions {
+	options.Issuer = p.Metadata.Issuer
+	options.AllowedAlgorithms = p.Metadata.IDTokenSigningAlgValuesSupported
+	options.AllowedKeyAlgorithms = p.Metadata.IDTokenEncryptionAlgValuesSupported
+	options.AllowedContentEncryptions = p.Metadata.IDTokenEncryptionEncValuesSupported
+	return options
+}
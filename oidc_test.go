@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newOIDCServer serves a discovery document for its own URL as the issuer,
+// changed by edit, and the key set under /jwks.
+func newOIDCServer(t *testing.T, jwks []byte, edit func(metadata map[string]any)) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case OIDCDiscoveryPath:
+			metadata := map[string]any{
+				"issuer":                                server.URL,
+				"jwks_uri":                              server.URL + "/jwks",
+				"id_token_signing_alg_values_supported": []string{"ES256"},
+			}
+			if edit != nil {
+				edit(metadata)
+			}
+			json.NewEncoder(w).Encode(metadata)
+		case "/jwks":
+			w.Write(jwks)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestDiscoverOIDCProvider(t *testing.T) {
+	key := testKey(t, KeyKindECP256)
+	server := newOIDCServer(t, key.JWKS, nil)
+
+	provider, err := DiscoverOIDCProvider(context.Background(), server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("DiscoverOIDCProvider: %v", err)
+	}
+	if provider.Metadata.JWKSURI != server.URL+"/jwks" {
+		t.Errorf("jwks_uri = %s", provider.Metadata.JWKSURI)
+	}
+
+	set, err := provider.JWKS.KeySet(context.Background(), key.KeyID)
+	if err != nil {
+		t.Fatalf("KeySet: %v", err)
+	}
+
+	signingKey, err := ParseSigningKey(jwt.SigningMethodES256, key.PrivatePEM, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := jwt.MapClaims{"iss": server.URL, "sub": "alice"}
+	sign := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = key.KeyID
+		signed, err := token.SignedString(signingKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	options := provider.DecodeOptions(JWTDecodeOptions{KeySet: set})
+	if result := JWTDecodeToken(sign(claims), options); !result.Valid() {
+		t.Errorf("provider token: issues %v, key error %v", result.Issues, result.KeyError)
+	}
+
+	other := jwt.MapClaims{"iss": "https://other.example", "sub": "alice"}
+	if result := JWTDecodeToken(sign(other), options); !slices.Contains(result.Issues, IssueInvalidIssuer) {
+		t.Errorf("other issuer: issues %v, want %s", result.Issues, IssueInvalidIssuer)
+	}
+}
+
+func TestOIDCProviderDecodeOptionsAlgorithms(t *testing.T) {
+	key := testKey(t, KeyKindECP256)
+	server := newOIDCServer(t, key.JWKS, func(metadata map[string]any) {
+		metadata["id_token_signing_alg_values_supported"] = []string{"RS256"}
+		metadata["id_token_encryption_alg_values_supported"] = []string{"RSA-OAEP-256"}
+		metadata["id_token_encryption_enc_values_supported"] = []string{"A256GCM"}
+	})
+
+	provider, err := DiscoverOIDCProvider(context.Background(), server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("DiscoverOIDCProvider: %v", err)
+	}
+
+	options := provider.DecodeOptions(JWTDecodeOptions{Secret: "secret"})
+	if want := []string{"RS256"}; !slices.Equal(options.AllowedAlgorithms, want) {
+		t.Errorf("allowed algorithms = %v, want %v", options.AllowedAlgorithms, want)
+	}
+	if want := []string{"RSA-OAEP-256"}; !slices.Equal(options.AllowedKeyAlgorithms, want) {
+		t.Errorf("allowed key algorithms = %v, want %v", options.AllowedKeyAlgorithms, want)
+	}
+	if want := []string{"A256GCM"}; !slices.Equal(options.AllowedContentEncryptions, want) {
+		t.Errorf("allowed content encryptions = %v, want %v", options.AllowedContentEncryptions, want)
+	}
+	if options.Issuer != server.URL || options.Secret != "secret" {
+		t.Errorf("issuer %q, secret %q: options not carried over", options.Issuer, options.Secret)
+	}
+
+	set := testKeySet(t, key)
+	result := JWTDecodeToken(signTestTokenWithKey(t, key, key.KeyID), provider.DecodeOptions(JWTDecodeOptions{KeySet: set}))
+	if !slices.Contains(result.Issues, IssueAlgNotAllowed) {
+		t.Errorf("ES256 token from an RS256 provider: issues %v, want %s", result.Issues, IssueAlgNotAllowed)
+	}
+}
+
+func TestDiscoverOIDCProviderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		edit    func(metadata map[string]any)
+		issuer  func(url string) string
+		message string
+	}{
+		{
+			name:    "issuer mismatch",
+			edit:    func(m map[string]any) { m["issuer"] = "https://evil.example" },
+			message: "provider reports issuer",
+		},
+		{
+			name:    "trailing slash",
+			issuer:  func(url string) string { return url + "/" },
+			message: "provider reports issuer",
+		},
+		{
+			name:    "no jwks_uri",
+			edit:    func(m map[string]any) { delete(m, "jwks_uri") },
+			message: "no jwks_uri",
+		},
+		{
+			name:    "not found",
+			issuer:  func(url string) string { return url + "/tenant" },
+			message: "unexpected status",
+		},
+		{
+			name:    "invalid metadata",
+			edit:    func(m map[string]any) { m["jwks_uri"] = 42 },
+			message: "invalid provider metadata",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newOIDCServer(t, nil, tt.edit)
+			issuer := server.URL
+			if tt.issuer != nil {
+				issuer = tt.issuer(server.URL)
+			}
+
+			_, err := DiscoverOIDCProvider(context.Background(), issuer, server.Client())
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.message)
+			}
+		})
+	}
+}
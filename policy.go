@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ValidationPolicy lists what a token is expected to contain. Empty fields
+// are not checked.
+type ValidationPolicy struct {
+	Issuers           []string       `json:"issuers,omitempty"`
+	Audiences         []string       `json:"audiences,omitempty"`
+	Subjects          []string       `json:"subjects,omitempty"`
+	RequiredClaims    []string       `json:"required_claims,omitempty"`
+	AllowedAlgorithms []string       `json:"allowed_algorithms,omitempty"`
+	MaxLifetime       PolicyDuration `json:"max_lifetime,omitempty"`
+}
+
+// PolicyDuration is a duration written as a string such as "1h" or as a
+// number of seconds in policy files.
+type PolicyDuration time.Duration
+
+func (d *PolicyDuration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = PolicyDuration(seconds * float64(time.Second))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1h\" or a number of seconds")
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = PolicyDuration(parsed)
+	return nil
+}
+
+func (d PolicyDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ParsePolicy parses a policy file.
+func ParsePolicy(data []byte) (*ValidationPolicy, error) {
+	var policy ValidationPolicy
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// IsZero reports whether the policy checks nothing.
+func (p ValidationPolicy) IsZero() bool {
+	return len(p.Issuers) == 0 && len(p.Audiences) == 0 && len(p.Subjects) == 0 &&
+		len(p.RequiredClaims) == 0 && len(p.AllowedAlgorithms) == 0 && p.MaxLifetime == 0
+}
+
+// policyCheck is a check of a policy with the issue its failure raises.
+type policyCheck struct {
+	JWTCheck
+	Issue JWTIssue
+}
+
+// ValidatePolicy checks a decoded token against the policy, one check per
+// rule.
+func ValidatePolicy(result *JWTDecodeResult, policy ValidationPolicy) []JWTCheck {
+	var checks []JWTCheck
+	for _, c := range validatePolicy(result, policy) {
+		checks = append(checks, c.JWTCheck)
+	}
+	return checks
+}
+
+// validatePolicy runs the checks of ValidatePolicy. Mismatching iss, aud and
+// alg values raise the same issues as the built in validation, a missing iss
+// or aud and every other check raise IssuePolicyFailed.
+func validatePolicy(result *JWTDecodeResult, policy ValidationPolicy) []policyCheck {
+	var checks []policyCheck
+	check := func(name string, issue JWTIssue, passed bool, format string, args ...any) {
+		checks = append(checks, policyCheck{
+			JWTCheck: JWTCheck{Name: name, Passed: passed, Message: fmt.Sprintf(format, args...)},
+			Issue:    issue,
+		})
+	}
+
+	if result.Token == nil {
+		check("token", IssuePolicyFailed, false, "token could not be decoded")
+		return checks
+	}
+
+	claims, _ := result.Token.Claims.(jwt.MapClaims)
+
+	if len(policy.Issuers) > 0 {
+		if iss, ok := claims["iss"].(string); ok {
+			check("iss", IssueInvalidIssuer, slices.Contains(policy.Issuers, iss), "iss %q must be one of %s", iss, strings.Join(policy.Issuers, ", "))
+		} else {
+			check("iss", IssuePolicyFailed, false, "iss must be present and one of %s", strings.Join(policy.Issuers, ", "))
+		}
+	}
+
+	if len(policy.Audiences) > 0 {
+		if aud, _ := claims.GetAudience(); len(aud) > 0 {
+			matched := slices.ContainsFunc(aud, func(a string) bool { return slices.Contains(policy.Audiences, a) })
+			check("aud", IssueInvalidAudience, matched, "aud %v must include one of %s", []string(aud), strings.Join(policy.Audiences, ", "))
+		} else {
+			check("aud", IssuePolicyFailed, false, "aud must be present and include one of %s", strings.Join(policy.Audiences, ", "))
+		}
+	}
+
+	if len(policy.Subjects) > 0 {
+		sub, _ := claims["sub"].(string)
+		check("sub", IssuePolicyFailed, slices.Contains(policy.Subjects, sub), "sub %q must be one of %s", sub, strings.Join(policy.Subjects, ", "))
+	}
+
+	for _, name := range policy.RequiredClaims {
+		_, ok := claims[name]
+		check(name, IssuePolicyFailed, ok, "%s must be present", name)
+	}
+
+	if len(policy.AllowedAlgorithms) > 0 {
+		check("alg", IssueAlgNotAllowed, slices.Contains(policy.AllowedAlgorithms, result.Algorithm), "alg %q must be one of %s", result.Algorithm, strings.Join(policy.AllowedAlgorithms, ", "))
+	}
+
+	if policy.MaxLifetime > 0 {
+		maxLifetime := time.Duration(policy.MaxLifetime)
+		exp, hasExp := NumericDateClaim(claims, "exp")
+		iat, hasIAT := NumericDateClaim(claims, "iat")
+
+		switch {
+		case !hasExp:
+			check("lifetime", IssuePolicyFailed, false, "exp must be present to limit the lifetime to %s", maxLifetime)
+		case !hasIAT:
+			check("lifetime", IssuePolicyFailed, false, "iat must be present to limit the lifetime to %s", maxLifetime)
+		default:
+			lifetime := exp.Sub(iat)
+			check("lifetime", IssuePolicyFailed, lifetime <= maxLifetime, "lifetime %s must not exceed %s", lifetime, maxLifetime)
+		}
+	}
+
+	return checks
+}
+
+// applyPolicy runs the policy checks when a policy is set, raising the issue
+// of every failed one.
+func applyPolicy(result *JWTDecodeResult, options JWTDecodeOptions) {
+	if options.Policy == nil || options.Policy.IsZero() {
+		return
+	}
+
+	for _, c := range validatePolicy(result, *options.Policy) {
+		result.Checks = append(result.Checks, c.JWTCheck)
+
+		if !c.Passed && !result.Has(c.Issue) {
+			result.Issues = append(result.Issues, c.Issue)
+		}
+	}
+}
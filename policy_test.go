@@ -0,0 +1,111 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{"issuers": ["https://issuer.example"], "max_lifetime": "1h"}`))
+	if err != nil {
+		t.Fatalf("ParsePolicy: %v", err)
+	}
+	if time.Duration(policy.MaxLifetime) != time.Hour || !slices.Equal(policy.Issuers, []string{"https://issuer.example"}) {
+		t.Errorf("policy = %+v", policy)
+	}
+
+	seconds, err := ParsePolicy([]byte(`{"max_lifetime": 90}`))
+	if err != nil || time.Duration(seconds.MaxLifetime) != 90*time.Second {
+		t.Errorf("max_lifetime 90 = %v, %v, want 1m30s", seconds, err)
+	}
+
+	for _, invalid := range []string{
+		`{"issuer": "https://issuer.example"}`,
+		`{"max_lifetime": "soon"}`,
+		`{"max_lifetime": true}`,
+		`{"audiences": "my-api"}`,
+		`not json`,
+	} {
+		if _, err := ParsePolicy([]byte(invalid)); err == nil {
+			t.Errorf("ParsePolicy(%s) succeeded", invalid)
+		}
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	token := signTestToken(t, jwt.MapClaims{
+		"iss":   "https://issuer.example",
+		"aud":   []string{"my-api", "other-api"},
+		"sub":   "alice",
+		"scope": "read",
+		"iat":   now.Add(-time.Minute).Unix(),
+		"exp":   now.Add(2 * time.Hour).Unix(),
+	}, "secret")
+
+	tests := []struct {
+		name   string
+		policy ValidationPolicy
+		issues []JWTIssue
+	}{
+		{"empty", ValidationPolicy{}, nil},
+		{"matching", ValidationPolicy{Issuers: []string{"https://issuer.example"}, Audiences: []string{"my-api"}, Subjects: []string{"alice"}, RequiredClaims: []string{"scope"}, AllowedAlgorithms: []string{"HS256"}}, nil},
+		{"issuer", ValidationPolicy{Issuers: []string{"https://other.example"}}, []JWTIssue{IssueInvalidIssuer}},
+		{"audience", ValidationPolicy{Audiences: []string{"admin-api"}}, []JWTIssue{IssueInvalidAudience}},
+		{"subject", ValidationPolicy{Subjects: []string{"bob"}}, []JWTIssue{IssuePolicyFailed}},
+		{"required claims", ValidationPolicy{RequiredClaims: []string{"scope", "tenant", "roles"}}, []JWTIssue{IssuePolicyFailed}},
+		{"algorithm", ValidationPolicy{AllowedAlgorithms: []string{"RS256", "ES256"}}, []JWTIssue{IssueAlgNotAllowed}},
+		{"lifetime", ValidationPolicy{MaxLifetime: PolicyDuration(time.Hour)}, []JWTIssue{IssuePolicyFailed}},
+		{"lifetime within limit", ValidationPolicy{MaxLifetime: PolicyDuration(3 * time.Hour)}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := JWTDecodeToken(token, JWTDecodeOptions{Secret: "secret", At: now, Policy: &tt.policy})
+
+			if !slices.Equal(result.Issues, tt.issues) {
+				t.Errorf("issues = %v, want %v\n%s", result.Issues, tt.issues, FormatChecks(result.Checks))
+			}
+		})
+	}
+}
+
+func TestValidatePolicyMissingIssuerAudience(t *testing.T) {
+	token := signTestToken(t, jwt.MapClaims{"sub": "alice"}, "secret")
+
+	tests := []struct {
+		name   string
+		policy ValidationPolicy
+	}{
+		{"issuer", ValidationPolicy{Issuers: []string{"https://issuer.example"}}},
+		{"audience", ValidationPolicy{Audiences: []string{"my-api"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := JWTDecodeToken(token, JWTDecodeOptions{Secret: "secret", Policy: &tt.policy})
+
+			if want := []JWTIssue{IssuePolicyFailed}; !slices.Equal(result.Issues, want) {
+				t.Errorf("issues = %v, want %v\n%s", result.Issues, want, FormatChecks(result.Checks))
+			}
+		})
+	}
+}
+
+func TestValidatePolicyLifetimeClaims(t *testing.T) {
+	policy := ValidationPolicy{MaxLifetime: PolicyDuration(time.Hour)}
+
+	for _, missing := range []string{"exp", "iat"} {
+		claims := jwt.MapClaims{"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix()}
+		delete(claims, missing)
+		result := JWTDecodeToken(signTestToken(t, claims, "secret"), JWTDecodeOptions{Secret: "secret"})
+
+		checks := ValidatePolicy(result, policy)
+		if len(checks) != 1 || checks[0].Passed {
+			t.Errorf("without %s: checks %v, want a failed lifetime check", missing, checks)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+)
+
+const (
+	// DefaultJWKSCacheTTL is used when the server sends no Cache-Control max-age.
+	DefaultJWKSCacheTTL = 5 * time.Minute
+	// DefaultJWKSRefetchInterval limits how often an unknown kid or a failed
+	// fetch triggers another request.
+	DefaultJWKSRefetchInterval = 10 * time.Second
+)
+
+// RemoteJWKS fetches a JWK Set from a URL and caches it, revalidating with
+// ETag once the Cache-Control max-age runs out and refetching when a token
+// names a kid that is not in the cached set.
+type RemoteJWKS struct {
+	URL             string
+	Client          *http.Client
+	RefetchInterval time.Duration
+	Now             func() time.Time
+
+	mu          sync.Mutex
+	set         *jose.JSONWebKeySet
+	etag        string
+	expiresAt   time.Time
+	lastAttempt time.Time
+	lastErr     error
+}
+
+// NewRemoteJWKS creates a cache for the JWK Set at url. A nil client uses
+// http.DefaultClient.
+func NewRemoteJWKS(url string, client *http.Client) *RemoteJWKS {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &RemoteJWKS{
+		URL:             url,
+		Client:          client,
+		RefetchInterval: DefaultJWKSRefetchInterval,
+		Now:             time.Now,
+	}
+}
+
+// KeySet returns the key set for a token with the given kid, fetching it
+// first when the cache is empty, expired or does not know the kid.
+func (r *RemoteJWKS) KeySet(ctx context.Context, kid string) (*jose.JSONWebKeySet, error) {
+	if set, stale := r.Cached(kid); !stale {
+		return set, nil
+	}
+
+	if err := r.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	set, _ := r.Cached(kid)
+	return set, nil
+}
+
+// Cached returns the cached key set without any network access, and whether
+// it should be refreshed before verifying a token with the given kid.
+func (r *RemoteJWKS) Cached(kid string) (*jose.JSONWebKeySet, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.Now()
+	canRetry := r.lastAttempt.IsZero() || now.Sub(r.lastAttempt) >= r.RefetchInterval
+
+	switch {
+	case r.set == nil:
+		return nil, canRetry
+	case !now.Before(r.expiresAt):
+		return r.set, canRetry
+	case kid != "" && len(r.set.Key(kid)) == 0:
+		return r.set, canRetry
+	default:
+		return r.set, false
+	}
+}
+
+// Err returns the error of the last fetch, if it failed.
+func (r *RemoteJWKS) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastErr
+}
+
+// Refresh fetches the key set, sending the cached ETag so an unchanged set
+// only extends the cache lifetime.
+func (r *RemoteJWKS) Refresh(ctx context.Context) error {
+	r.mu.Lock()
+	etag := r.etag
+	hasSet := r.set != nil
+	r.lastAttempt = r.Now()
+	r.mu.Unlock()
+
+	set, newETag, ttl, err := r.fetch(ctx, etag, hasSet)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastErr = err
+	if err != nil {
+		return err
+	}
+
+	if set != nil {
+		r.set = set
+		r.etag = newETag
+	}
+	r.expiresAt = r.Now().Add(ttl)
+
+	return nil
+}
+
+func (r *RemoteJWKS) fetch(ctx context.Context, etag string, conditional bool) (*jose.JSONWebKeySet, string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	req.Header.Set("Accept", "application/jwk-set+json, application/json")
+	if conditional && etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	ttl := cacheTTL(resp.Header.Get("Cache-Control"))
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && conditional:
+		return nil, etag, ttl, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, "", 0, fmt.Errorf("fetching JWKS: unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("fetching JWKS: %w", err)
+	}
+
+	set, err := ParseJWKSet(body)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	return set, resp.Header.Get("ETag"), ttl, nil
+}
+
+// cacheTTL returns how long a response may be cached according to its
+// Cache-Control header.
+func cacheTTL(cacheControl string) time.Duration {
+	if cacheControl == "" {
+		return DefaultJWKSCacheTTL
+	}
+
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || seconds < 0 {
+				return 0
+			}
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	return DefaultJWKSCacheTTL
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jwksServer serves a key set with an ETag, answering conditional requests
+// for the current one with 304 Not Modified.
+type jwksServer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	body         string
+	etag         string
+	cacheControl string
+	status       int
+	requests     int
+	conditional  int
+}
+
+func newJWKSServer(t *testing.T, body, etag, cacheControl string) *jwksServer {
+	t.Helper()
+
+	s := &jwksServer{body: body, etag: etag, cacheControl: cacheControl, status: http.StatusOK}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests++
+		if s.cacheControl != "" {
+			w.Header().Set("Cache-Control", s.cacheControl)
+		}
+		if s.status != http.StatusOK {
+			w.WriteHeader(s.status)
+			return
+		}
+		if match := r.Header.Get("If-None-Match"); match != "" {
+			s.conditional++
+			if match == s.etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Header().Set("ETag", s.etag)
+		w.Write([]byte(s.body))
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *jwksServer) serve(body, etag string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body, s.etag, s.status = body, etag, status
+}
+
+func (s *jwksServer) counts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, s.conditional
+}
+
+// testClock is a settable time source for RemoteJWKS.Now.
+type testClock struct{ now time.Time }
+
+func (c *testClock) Now() time.Time          { return c.now }
+func (c *testClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestRemoteJWKS(s *jwksServer) (*RemoteJWKS, *testClock) {
+	clock := &testClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	jwks := NewRemoteJWKS(s.URL, s.Client())
+	jwks.Now = clock.Now
+	return jwks, clock
+}
+
+func keySetWithKid(t *testing.T, jwks *RemoteJWKS, kid string) {
+	t.Helper()
+
+	set, err := jwks.KeySet(context.Background(), kid)
+	if err != nil {
+		t.Fatalf("KeySet(%q): %v", kid, err)
+	}
+	if len(set.Key(kid)) == 0 {
+		t.Fatalf("KeySet(%q) has no key %q", kid, kid)
+	}
+}
+
+func TestRemoteJWKSRevalidatesWithETag(t *testing.T) {
+	key := testKey(t, KeyKindECP256)
+	server := newJWKSServer(t, string(key.JWKS), `"v1"`, "public, max-age=60")
+	jwks, clock := newTestRemoteJWKS(server)
+
+	keySetWithKid(t, jwks, key.KeyID)
+	first, _ := jwks.Cached(key.KeyID)
+
+	// Within max-age the cached set is used without a request.
+	clock.Advance(59 * time.Second)
+	keySetWithKid(t, jwks, key.KeyID)
+	if requests, _ := server.counts(); requests != 1 {
+		t.Fatalf("requests within max-age = %d, want 1", requests)
+	}
+
+	// Once it runs out the set is revalidated and the 304 keeps it.
+	clock.Advance(time.Second)
+	keySetWithKid(t, jwks, key.KeyID)
+	if requests, conditional := server.counts(); requests != 2 || conditional != 1 {
+		t.Fatalf("requests = %d, conditional = %d, want 2 and 1", requests, conditional)
+	}
+	if second, _ := jwks.Cached(key.KeyID); second != first {
+		t.Error("304 Not Modified replaced the cached key set")
+	}
+
+	// The 304 extended the cache lifetime by its max-age.
+	clock.Advance(59 * time.Second)
+	keySetWithKid(t, jwks, key.KeyID)
+	if requests, _ := server.counts(); requests != 2 {
+		t.Errorf("requests after revalidation = %d, want 2", requests)
+	}
+}
+
+func TestRemoteJWKSRefetchesUnknownKid(t *testing.T) {
+	oldKey := testKey(t, KeyKindECP256)
+	newKey := testKey(t, KeyKindECP384)
+	server := newJWKSServer(t, string(oldKey.JWKS), `"v1"`, "max-age=3600")
+	jwks, clock := newTestRemoteJWKS(server)
+
+	keySetWithKid(t, jwks, oldKey.KeyID)
+
+	// The provider rotates its key before the cache expires.
+	server.serve(string(newKey.JWKS), `"v2"`, http.StatusOK)
+
+	if _, stale := jwks.Cached(newKey.KeyID); stale {
+		t.Error("unknown kid refetched before the refetch interval passed")
+	}
+
+	clock.Advance(DefaultJWKSRefetchInterval)
+	keySetWithKid(t, jwks, newKey.KeyID)
+	if requests, _ := server.counts(); requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+
+	// A kid missing from the new set too does not fetch again right away.
+	if _, err := jwks.KeySet(context.Background(), "missing"); err != nil {
+		t.Fatalf("KeySet(missing): %v", err)
+	}
+	if requests, _ := server.counts(); requests != 2 {
+		t.Errorf("requests after unknown kid = %d, want 2", requests)
+	}
+}
+
+func TestRemoteJWKSErrors(t *testing.T) {
+	key := testKey(t, KeyKindECP256)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"server error", string(key.JWKS), http.StatusInternalServerError},
+		{"not a key set", "<html></html>", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newJWKSServer(t, tt.body, `"v1"`, "")
+			server.serve(tt.body, `"v1"`, tt.status)
+			jwks, clock := newTestRemoteJWKS(server)
+
+			if _, err := jwks.KeySet(context.Background(), key.KeyID); err == nil {
+				t.Fatal("KeySet succeeded")
+			}
+			if jwks.Err() == nil {
+				t.Error("Err() = nil after a failed fetch")
+			}
+
+			// Failures are not retried on every token.
+			if set, stale := jwks.Cached(key.KeyID); set != nil || stale {
+				t.Errorf("Cached() = %v, %v right after a failure, want nil, false", set, stale)
+			}
+
+			server.serve(string(key.JWKS), `"v1"`, http.StatusOK)
+			clock.Advance(DefaultJWKSRefetchInterval)
+			keySetWithKid(t, jwks, key.KeyID)
+			if err := jwks.Err(); err != nil {
+				t.Errorf("Err() = %v after a successful fetch", err)
+			}
+		})
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		cacheControl string
+		want         time.Duration
+	}{
+		{"", DefaultJWKSCacheTTL},
+		{"public", DefaultJWKSCacheTTL},
+		{"max-age=60", time.Minute},
+		{"public, MAX-AGE=\"30\"", 30 * time.Second},
+		{"max-age=-1", 0},
+		{"max-age=soon", 0},
+		{"no-store", 0},
+		{"no-cache, max-age=60", 0},
+	}
+
+	for _, tt := range tests {
+		if got := cacheTTL(tt.cacheControl); got != tt.want {
+			t.Errorf("cacheTTL(%q) = %s, want %s", tt.cacheControl, got, tt.want)
+		}
+	}
+}
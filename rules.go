@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"cel.dev/cel-go/cel"
+	"cel.dev/cel-go/ext"
+)
+
+// Rule is a CEL expression over the token's header and claims that must
+// evaluate to true, e.g.
+//
+//	"admin" in claims.roles && claims.tenant == header.kid.split(":")[0]
+type Rule struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+	// Message explains a failure, the expression is shown when empty.
+	Message string `json:"message,omitempty"`
+}
+
+// RuleSet is a compiled rules file.
+type RuleSet struct {
+	rules    []Rule
+	programs []cel.Program
+}
+
+// ruleEnv declares the variables available to rules.
+func ruleEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("header", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("claims", cel.MapType(cel.StringType, cel.DynType)),
+		cel.CrossTypeNumericComparisons(true),
+		ext.Strings(),
+		ext.Lists(),
+		ext.Sets(),
+	)
+}
+
+// ParseRules compiles a rules file:
+//
+//	{"rules": [{"name": "admin", "expression": "\"admin\" in claims.roles"}]}
+func ParseRules(data []byte) (*RuleSet, error) {
+	var file struct {
+		Rules []Rule `json:"rules"`
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid rules: %w", err)
+	}
+
+	env, err := ruleEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	set := &RuleSet{}
+	for i, rule := range file.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		ast, issues := env.Compile(rule.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("rule %q: must evaluate to a bool, not %s", rule.Name, ast.OutputType())
+		}
+
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+
+		set.rules = append(set.rules, rule)
+		set.programs = append(set.programs, program)
+	}
+
+	return set, nil
+}
+
+// Evaluate runs every rule against the header and claims, one check per rule.
+func (s *RuleSet) Evaluate(header, claims any) []JWTCheck {
+	vars := map[string]any{
+		"header": plainJSON(header),
+		"claims": plainJSON(claims),
+	}
+
+	checks := make([]JWTCheck, 0, len(s.rules))
+	for i, rule := range s.rules {
+		check := JWTCheck{Name: rule.Name}
+
+		out, _, err := s.programs[i].Eval(vars)
+		switch {
+		case err != nil:
+			check.Message = fmt.Sprintf("%s: %v", rule.Expression, err)
+		case out.Value() == true:
+			check.Passed = true
+			check.Message = rule.Expression
+		case out.Value() != false:
+			check.Message = fmt.Sprintf("%s gives %v, not a bool", rule.Expression, out.Value())
+		case rule.Message != "":
+			check.Message = rule.Message
+		default:
+			check.Message = rule.Expression + " is false"
+		}
+
+		checks = append(checks, check)
+	}
+
+	return checks
+}
+
+// plainJSON converts v to the maps, slices and floats JSON decodes into, so
+// claims of any type are seen the same way by rules. Anything that is not a
+// JSON object becomes an empty map.
+func plainJSON(v any) map[string]any {
+	plain := map[string]any{}
+	if raw, err := json.Marshal(v); err == nil {
+		_ = json.Unmarshal(raw, &plain)
+	}
+	return plain
+}
+
+// applyRules evaluates the rules when a rule set is given.
+func applyRules(result *JWTDecodeResult, options JWTDecodeOptions) {
+	if options.Rules == nil || result.Token == nil {
+		return
+	}
+
+	checks := options.Rules.Evaluate(result.Token.Header, result.Token.Claims)
+	result.Checks = append(result.Checks, checks...)
+	for _, c := range checks {
+		if !c.Passed {
+			result.Issues = append(result.Issues, IssueRulesFailed)
+			break
+		}
+	}
+}
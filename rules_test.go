@@ -0,0 +1,99 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		message string
+	}{
+		{"valid", `{"rules": [{"name": "admin", "expression": "\"admin\" in claims.roles"}]}`, ""},
+		{"dynamic result", `{"rules": [{"expression": "claims.admin"}]}`, ""},
+		{"unknown field", `{"rules": [{"name": "admin", "expr": "true"}]}`, "invalid rules"},
+		{"syntax error", `{"rules": [{"name": "broken", "expression": "claims.roles &&"}]}`, `rule "broken"`},
+		{"undeclared variable", `{"rules": [{"expression": "payload.sub == 'alice'"}]}`, `rule "rule 1"`},
+		{"not a bool", `{"rules": [{"name": "count", "expression": "size(claims)"}]}`, "must evaluate to a bool"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRules([]byte(tt.rules))
+			switch {
+			case tt.message == "" && err != nil:
+				t.Errorf("ParseRules: %v", err)
+			case tt.message != "" && (err == nil || !strings.Contains(err.Error(), tt.message)):
+				t.Errorf("error = %v, want it to contain %q", err, tt.message)
+			}
+		})
+	}
+}
+
+func TestRuleSetEvaluate(t *testing.T) {
+	rules, err := ParseRules([]byte(`{"rules": [
+		{"name": "admin", "expression": "\"admin\" in claims.roles", "message": "admins only"},
+		{"name": "tenant", "expression": "claims.tenant == header.kid.split(\":\")[0]"},
+		{"name": "fresh", "expression": "claims.exp - claims.iat <= 3600"},
+		{"name": "flag", "expression": "claims.flag"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := map[string]any{"alg": "HS256", "kid": "acme:2024"}
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		failed []string
+	}{
+		{"all pass", jwt.MapClaims{"roles": []string{"admin"}, "tenant": "acme", "iat": 0, "exp": 3600, "flag": true}, nil},
+		{"not admin", jwt.MapClaims{"roles": []string{"user"}, "tenant": "acme", "iat": 0, "exp": 60, "flag": true}, []string{"admin"}},
+		{"other tenant", jwt.MapClaims{"roles": []string{"admin"}, "tenant": "evil", "iat": 0, "exp": 60, "flag": true}, []string{"tenant"}},
+		{"missing claims", jwt.MapClaims{}, []string{"admin", "tenant", "fresh", "flag"}},
+		{"not a bool", jwt.MapClaims{"roles": []string{"admin"}, "tenant": "acme", "iat": 0, "exp": 60, "flag": "yes"}, []string{"flag"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checks := rules.Evaluate(header, tt.claims)
+
+			var failed []string
+			for _, c := range checks {
+				if !c.Passed {
+					failed = append(failed, c.Name)
+				}
+			}
+			if !slices.Equal(failed, tt.failed) {
+				t.Errorf("failed rules %v, want %v\n%s", failed, tt.failed, FormatChecks(checks))
+			}
+		})
+	}
+
+	checks := rules.Evaluate(header, jwt.MapClaims{"roles": []string{}})
+	if checks[0].Message != "admins only" {
+		t.Errorf("message = %q, want the rule's message", checks[0].Message)
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	rules, err := ParseRules([]byte(`{"rules": [{"expression": "claims.sub == 'alice'"}, {"expression": "header.alg == 'HS256'"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for sub, want := range map[string][]JWTIssue{"alice": nil, "bob": {IssueRulesFailed}} {
+		result := JWTDecodeToken(signTestToken(t, jwt.MapClaims{"sub": sub}, "secret"), JWTDecodeOptions{Secret: "secret", Rules: rules})
+		if !slices.Equal(result.Issues, want) {
+			t.Errorf("sub %s: issues = %v, want %v", sub, result.Issues, want)
+		}
+		if len(result.Checks) != 2 {
+			t.Errorf("sub %s: %d checks, want 2", sub, len(result.Checks))
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+)
+
+// schemaURL is the location the token schema is compiled under. Schemas are
+// never fetched, references to other documents fail to compile.
+const schemaURL = "jwtx:///token.schema.json"
+
+// TokenSchema is a JSON Schema a token must match. It is applied to a
+// document holding the token's header and claims:
+//
+//	{"header": {"alg": "RS256", ...}, "claims": {"sub": "alice", ...}}
+type TokenSchema struct {
+	schema *jsonschema.Schema
+}
+
+// SchemaViolation is a part of a token that does not match the schema.
+type SchemaViolation struct {
+	// Pointer is the JSON pointer of the offending value, e.g. "/claims/aud".
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+func (v SchemaViolation) String() string {
+	pointer := v.Pointer
+	if pointer == "" {
+		pointer = "(root)"
+	}
+	return fmt.Sprintf("%s: %s", pointer, v.Message)
+}
+
+// ParseTokenSchema compiles a JSON Schema, draft 2020-12 unless its $schema
+// says otherwise.
+func ParseTokenSchema(data []byte) (*TokenSchema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft2020)
+	compiler.UseLoader(jsonschema.SchemeURLLoader{})
+	if err := compiler.AddResource(schemaURL, doc); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	schema, err := compiler.Compile(schemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	return &TokenSchema{schema: schema}, nil
+}
+
+// Validate checks a header and claims against the schema and returns every
+// violation found.
+func (s *TokenSchema) Validate(header, claims any) []SchemaViolation {
+	// Round trip through JSON so claims of any type validate as plain values.
+	raw, err := json.Marshal(map[string]any{"header": header, "claims": claims})
+	if err != nil {
+		return []SchemaViolation{{Message: err.Error()}}
+	}
+
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return []SchemaViolation{{Message: err.Error()}}
+	}
+
+	err = s.schema.Validate(instance)
+	if err == nil {
+		return nil
+	}
+
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []SchemaViolation{{Message: err.Error()}}
+	}
+
+	var violations []SchemaViolation
+	for _, unit := range validationErr.BasicOutput().Errors {
+		// Groups only say that something below them failed.
+		if unit.Error == nil {
+			continue
+		}
+		if _, ok := unit.Error.Kind.(*kind.Group); ok {
+			continue
+		}
+		violations = append(violations, SchemaViolation{Pointer: unit.InstanceLocation, Message: unit.Error.String()})
+	}
+
+	slices.SortStableFunc(violations, func(a, b SchemaViolation) int { return cmp.Compare(a.Pointer, b.Pointer) })
+
+	return violations
+}
+
+// FormatSchemaViolations joins violations into a single status line.
+func FormatSchemaViolations(violations []SchemaViolation) string {
+	parts := make([]string, 0, len(violations))
+	for _, v := range violations {
+		parts = append(parts, v.String())
+	}
+	return strings.Join(parts, "; ")
+}
+
+// applySchema validates the decoded header and claims when a schema is set.
+func applySchema(result *JWTDecodeResult, options JWTDecodeOptions) {
+	if options.Schema == nil || result.Token == nil || result.Token.Claims == nil {
+		return
+	}
+
+	result.SchemaViolations = options.Schema.Validate(result.Token.Header, result.Token.Claims)
+	if len(result.SchemaViolations) > 0 {
+		result.Issues = append(result.Issues, IssueSchemaInvalid)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testTokenSchema = `{
+	"type": "object",
+	"properties": {
+		"header": {"properties": {"alg": {"enum": ["HS256", "RS256"]}}},
+		"claims": {
+			"required": ["sub", "exp"],
+			"properties": {
+				"sub": {"type": "string", "minLength": 1},
+				"roles": {"type": "array", "items": {"type": "string"}}
+			}
+		}
+	}
+}`
+
+func TestParseTokenSchema(t *testing.T) {
+	if _, err := ParseTokenSchema([]byte(testTokenSchema)); err != nil {
+		t.Fatalf("ParseTokenSchema: %v", err)
+	}
+
+	for _, invalid := range []string{
+		`not json`,
+		`{"type": "no-such-type"}`,
+		// Schemas are never fetched.
+		`{"$ref": "https://example.com/token.schema.json"}`,
+		`{"$ref": "file:///etc/passwd"}`,
+	} {
+		if _, err := ParseTokenSchema([]byte(invalid)); err == nil {
+			t.Errorf("ParseTokenSchema(%s) succeeded", invalid)
+		}
+	}
+}
+
+func TestTokenSchemaValidate(t *testing.T) {
+	schema, err := ParseTokenSchema([]byte(testTokenSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		header   map[string]any
+		claims   jwt.MapClaims
+		pointers []string
+	}{
+		{"valid", map[string]any{"alg": "HS256"}, jwt.MapClaims{"sub": "alice", "exp": 1, "roles": []string{"admin"}}, nil},
+		{"header", map[string]any{"alg": "none"}, jwt.MapClaims{"sub": "alice", "exp": 1}, []string{"/header/alg"}},
+		{"missing claim", map[string]any{"alg": "HS256"}, jwt.MapClaims{"sub": "alice"}, []string{"/claims"}},
+		{"several", map[string]any{"alg": "HS256"}, jwt.MapClaims{"sub": "", "exp": 1, "roles": []any{"admin", 7}}, []string{"/claims/roles/1", "/claims/sub"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := schema.Validate(tt.header, tt.claims)
+
+			var pointers []string
+			for _, v := range violations {
+				pointers = append(pointers, v.Pointer)
+			}
+			if !slices.Equal(pointers, tt.pointers) {
+				t.Errorf("violations at %v, want %v: %s", pointers, tt.pointers, FormatSchemaViolations(violations))
+			}
+		})
+	}
+}
+
+func TestApplySchema(t *testing.T) {
+	schema, err := ParseTokenSchema([]byte(testTokenSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := JWTDecodeToken(signTestToken(t, jwt.MapClaims{"sub": "alice"}, "secret"), JWTDecodeOptions{Secret: "secret", Schema: schema})
+	if !slices.Equal(result.Issues, []JWTIssue{IssueSchemaInvalid}) {
+		t.Errorf("issues = %v, want [%s]", result.Issues, IssueSchemaInvalid)
+	}
+	if got := FormatSchemaViolations(result.SchemaViolations); !strings.Contains(got, "exp") {
+		t.Errorf("violations %q do not name exp", got)
+	}
+}
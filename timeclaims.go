@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TimeClaimFormat is how time claims are shown next to their Unix value.
+const TimeClaimFormat = "2006-01-02 15:04:05 MST"
+
+// timeClaimLine matches a top level NumericDate claim in indented claims JSON.
+var timeClaimLine = regexp.MustCompile(`^  "(exp|iat|nbf|auth_time)": (-?[0-9]+(?:\.[0-9]+)?)(,?)$`)
+
+// AnnotateTimeClaims appends the absolute time in loc and the time relative
+// to now to every exp, iat, nbf and auth_time line of indented claims JSON.
+func AnnotateTimeClaims(claimsJSON string, now time.Time, loc *time.Location) string {
+	lines := strings.Split(claimsJSON, "\n")
+	for i, line := range lines {
+		match := timeClaimLine.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		seconds, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			continue
+		}
+
+		t := time.Unix(int64(seconds), 0)
+		lines[i] = fmt.Sprintf("%s  // %s, %s", line, t.In(loc).Format(TimeClaimFormat), DescribeTimeClaim(match[1], t, now))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// DescribeTimeClaim phrases a time claim relative to now, e.g. "expires in
+// 4m12s" or "issued 3 days ago".
+func DescribeTimeClaim(name string, t, now time.Time) string {
+	d := t.Sub(now)
+	past := d <= 0
+
+	switch name {
+	case "exp":
+		if past {
+			return "expired " + HumanizeDuration(-d) + " ago"
+		}
+		return "expires in " + HumanizeDuration(d)
+	case "nbf":
+		if past {
+			return "valid since " + HumanizeDuration(-d) + " ago"
+		}
+		return "valid in " + HumanizeDuration(d)
+	case "iat":
+		if past {
+			return "issued " + HumanizeDuration(-d) + " ago"
+		}
+		return "issued " + HumanizeDuration(d) + " in the future"
+	case "auth_time":
+		if past {
+			return "authenticated " + HumanizeDuration(-d) + " ago"
+		}
+		return "authenticated " + HumanizeDuration(d) + " in the future"
+	default:
+		if past {
+			return HumanizeDuration(-d) + " ago"
+		}
+		return "in " + HumanizeDuration(d)
+	}
+}
+
+// HumanizeDuration formats d with second precision below an hour, minute
+// precision below a day and in whole days above that.
+func HumanizeDuration(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return d.Truncate(time.Second).String()
+	case d < 24*time.Hour:
+		return strings.TrimSuffix(d.Truncate(time.Minute).String(), "0s")
+	case d < 48*time.Hour:
+		return "1 day"
+	default:
+		return fmt.Sprintf("%d days", int(d/(24*time.Hour)))
+	}
+}
+
+// ExpiryCountdown describes the exp claim relative to now, and whether the
+// token has expired.
+func ExpiryCountdown(token *jwt.Token, now time.Time) (string, bool) {
+	if token == nil || token.Claims == nil {
+		return "", false
+	}
+
+	exp, err := token.Claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return "", false
+	}
+
+	return DescribeTimeClaim("exp", exp.Time, now), !now.Before(exp.Time)
+}
+
+// ParseEvaluationTime reads the instant a token is evaluated at, given as
+// RFC 3339, as a date and time in loc, or as Unix seconds. Empty means now
+// and gives the zero time.
+func ParseEvaluationTime(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{time.DateTime, "2006-01-02T15:04:05", "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339, YYYY-MM-DD HH:MM:SS or Unix seconds", s)
+}
+
+// ParseLeeway reads a clock skew given as a duration such as 30s or 2m, or as
+// a number of seconds.
+func ParseLeeway(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	if seconds, err := strconv.Atoi(s); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid leeway %q, expected a duration such as 30s or 2m", s)
+	}
+
+	return d, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAnnotateTimeClaims(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	claims := strings.Join([]string{
+		"{",
+		`  "exp": 1714568400,`,
+		`  "iat": 1714564800.5,`,
+		`  "nested": {`,
+		`    "exp": 1714568400`,
+		`  },`,
+		`  "sub": "1714568400"`,
+		"}",
+	}, "\n")
+
+	lines := strings.Split(AnnotateTimeClaims(claims, now, time.UTC), "\n")
+
+	if want := `  "exp": 1714568400,  // 2024-05-01 13:00:00 UTC, expires in 1h0m`; lines[1] != want {
+		t.Errorf("exp line = %q, want %q", lines[1], want)
+	}
+	if want := `  "iat": 1714564800.5,  // 2024-05-01 12:00:00 UTC, issued 0s ago`; lines[2] != want {
+		t.Errorf("iat line = %q, want %q", lines[2], want)
+	}
+	// Only top level claims holding numbers are annotated.
+	for _, i := range []int{4, 6} {
+		if strings.Contains(lines[i], "//") {
+			t.Errorf("line %q was annotated", lines[i])
+		}
+	}
+}
+
+func TestDescribeTimeClaim(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		d    time.Duration
+		want string
+	}{
+		{"exp", 4*time.Minute + 12*time.Second, "expires in 4m12s"},
+		{"exp", -90 * time.Second, "expired 1m30s ago"},
+		{"exp", 0, "expired 0s ago"},
+		{"nbf", 2 * time.Hour, "valid in 2h0m"},
+		{"iat", -3 * 24 * time.Hour, "issued 3 days ago"},
+		{"iat", time.Minute, "issued 1m0s in the future"},
+		{"auth_time", -36 * time.Hour, "authenticated 1 day ago"},
+	}
+
+	for _, tt := range tests {
+		if got := DescribeTimeClaim(tt.name, now.Add(tt.d), now); got != tt.want {
+			t.Errorf("DescribeTimeClaim(%s, now%+v) = %q, want %q", tt.name, tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestExpiryCountdown(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	token := &jwt.Token{Claims: jwt.MapClaims{"exp": float64(now.Add(time.Minute).Unix())}}
+	if text, expired := ExpiryCountdown(token, now); text != "expires in 1m0s" || expired {
+		t.Errorf("ExpiryCountdown = %q, %v, want expires in 1m0s, false", text, expired)
+	}
+	if _, expired := ExpiryCountdown(token, now.Add(time.Minute)); !expired {
+		t.Error("token not expired at its exp")
+	}
+	if text, expired := ExpiryCountdown(&jwt.Token{Claims: jwt.MapClaims{}}, now); text != "" || expired {
+		t.Errorf("without exp: %q, %v", text, expired)
+	}
+}
+
+func TestParseEvaluationTime(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+
+	tests := []struct {
+		s    string
+		want time.Time
+	}{
+		{"", time.Time{}},
+		{"1714564800", time.Unix(1714564800, 0)},
+		{"2024-05-01T12:00:00Z", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{"2024-05-01T14:00:00+02:00", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{"2024-05-01 14:00:00", time.Date(2024, 5, 1, 14, 0, 0, 0, berlin)},
+		{"2024-05-01 14:00", time.Date(2024, 5, 1, 14, 0, 0, 0, berlin)},
+		{"2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, berlin)},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseEvaluationTime(tt.s, berlin)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseEvaluationTime(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"yesterday", "2024-13-01", "01/05/2024"} {
+		if _, err := ParseEvaluationTime(invalid, berlin); err == nil {
+			t.Errorf("ParseEvaluationTime(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestParseLeeway(t *testing.T) {
+	tests := []struct {
+		s    string
+		want time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{"30s", 30 * time.Second},
+		{" 2m ", 2 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got, err := ParseLeeway(tt.s); err != nil || got != tt.want {
+			t.Errorf("ParseLeeway(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"-5", "-1m", "soon"} {
+		if _, err := ParseLeeway(invalid); err == nil {
+			t.Errorf("ParseLeeway(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestJWTDecodeTokenAt(t *testing.T) {
+	issued := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	token := signTestToken(t, jwt.MapClaims{"iat": issued.Unix(), "nbf": issued.Unix(), "exp": issued.Add(time.Hour).Unix()}, "secret")
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		leeway time.Duration
+		issues []JWTIssue
+	}{
+		{"within lifetime", issued.Add(30 * time.Minute), 0, nil},
+		{"before nbf", issued.Add(-time.Minute), 0, []JWTIssue{IssueNotValidYet, IssueIssuedInFuture}},
+		{"before nbf within leeway", issued.Add(-time.Minute), 2 * time.Minute, nil},
+		{"after exp", issued.Add(61 * time.Minute), 0, []JWTIssue{IssueExpired}},
+		{"after exp within leeway", issued.Add(61 * time.Minute), 2 * time.Minute, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := JWTDecodeToken(token, JWTDecodeOptions{Secret: "secret", At: tt.at, Leeway: tt.leeway})
+			if !slices.Equal(result.Issues, tt.issues) {
+				t.Errorf("issues = %v, want %v", result.Issues, tt.issues)
+			}
+		})
+	}
+}
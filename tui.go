@@ -1,9 +1,12 @@
 package main
 
 import (
-	"encoding/json"
+	"crypto/rsa"
+	"fmt"
+	"slices"
+	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/go-jose/go-jose/v4"
 	zone "github.com/lrstanley/bubblezone/v2"
 
 	"charm.land/bubbles/v2/help"
@@ -12,32 +15,127 @@ import (
 	"charm.land/lipgloss/v2"
 )
 
-func NewBubbleTeamModel() BubbleTeaModel {
+// BubbleTeaModelOptions holds the values the decoder starts with.
+type BubbleTeaModelOptions struct {
+	Token  string
+	Secret string
+	// Passphrase decrypts the secret when it is an encrypted private key.
+	Passphrase string
+	// JWKS verifies tokens when the secret is left empty.
+	JWKS *RemoteJWKS
+	// Issuer is an OpenID Connect issuer discovered for verification.
+	Issuer string
+	// Audience is a value the aud claim of decoded tokens must contain.
+	Audience string
+	// IDToken enables the ID token checks panel.
+	IDToken *IDTokenExpectations
+	// TimeZone is the first zone time claims are shown in, Local by default.
+	TimeZone *time.Location
+	// Policy is the validation policy JSON the policy panel starts with.
+	Policy string
+	// Schema is a JSON Schema checked in both the decoder and the encoder.
+	Schema *TokenSchema
+	// Rules are CEL rules listed in the decoder's checks panel.
+	Rules *RuleSet
+}
+
+func NewBubbleTeamModel(options BubbleTeaModelOptions) BubbleTeaModel {
 	decoderJWTModel := NewPanelModel(ElementDecoderJWTTextArea, TitleJWTToken, PlaceholderJWT, true)
 	decoderSecretModel := NewPanelModel(ElementDecoderSecretTextArea, TitleSecret, PlaceholderSecret, true)
+	decoderPassphraseModel := NewMaskedPanelModel(ElementDecoderPassphraseInput, TitlePassphrase, PlaceholderPassphrase)
 	decoderHeaderModel := NewPanelModel(ElementDecoderHeaderTextArea, TitleDecodedHeader, "Enter header JSON here...", false)
 	decoderPayloadModel := NewPanelModel(ElementDecoderPayloadTextArea, TitleDecodedPayload, "Enter payload JSON here...", false)
+	decoderIssuerModel := NewCompactPanelModel(ElementDecoderIssuerInput, TitleIssuer, PlaceholderIssuer)
+	decoderChecksModel := NewPanelModel(ElementDecoderChecksView, TitleChecks, "", false)
+	decoderAtModel := NewCompactPanelModel(ElementDecoderAtInput, TitleAt, PlaceholderAt)
+	decoderLeewayModel := NewCompactPanelModel(ElementDecoderLeewayInput, TitleLeeway, PlaceholderLeeway)
+	decoderPolicyModel := NewPanelModel(ElementDecoderPolicyTextArea, TitlePolicy, PlaceholderPolicy, true)
+	decoderNestedModel := NewPanelModel(ElementDecoderNestedView, TitleNestedTokens, "", false)
 	encoderHeaderModel := NewPanelModel(ElementEncoderHeaderTextArea, TitleEncoderHeader, "Enter header JSON here...", true)
 	encoderPayloadModel := NewPanelModel(ElementEncoderPayloadTextArea, TitleEncoderPayload, "Enter payload JSON here...", true)
 	encoderSecretModel := NewPanelModel(ElementEncoderSecretTextArea, TitleSecret, PlaceholderSecret, true)
 	encoderJWTModel := NewPanelModel(ElementEncoderJWTTextArea, TitleJWTToken, PlaceholderJWT, false)
+	encoderPassphraseModel := NewMaskedPanelModel(ElementEncoderPassphraseInput, TitlePassphrase, PlaceholderPassphrase)
+	encoderRecipientModel := NewPanelModel(ElementEncoderRecipientTextArea, TitleRecipient, PlaceholderRecipient, true)
+	encoderFixtureTokenModel := NewPanelModel(ElementEncoderFixtureTokenTextArea, TitleFixtureToken, PlaceholderFixtureToken, true)
+	encoderFixtureKeyModel := NewPanelModel(ElementEncoderFixtureKeyTextArea, TitleFixtureKey, PlaceholderFixtureKey, true)
+	encoderFixturesModel := NewPanelModel(ElementEncoderFixturesView, TitleFixtures, "", false)
+	inspectorJWTModel := NewPanelModel(ElementInspectorJWTTextArea, TitleJWTToken, PlaceholderJWT, true)
+	inspectorSecretModel := NewPanelModel(ElementInspectorSecretTextArea, TitleSecret, PlaceholderInspectorSecret, true)
+	inspectorFindingsModel := NewPanelModel(ElementInspectorFindingsView, TitleFindings, "", false)
+	inspectorWordlistModel := NewCompactPanelModel(ElementInspectorWordlistInput, TitleWordlist, PlaceholderWordlist)
+	keygenLengthModel := NewCompactPanelModel(ElementKeygenLengthInput, TitleHMACLength, PlaceholderHMACLength)
+	keygenPrivateModel := NewPanelModel(ElementKeygenPrivateView, TitlePrivateKey, "", false)
+	keygenPublicModel := NewPanelModel(ElementKeygenPublicView, TitlePublicKey, "", false)
+
+	decoderJWTModel.SetValue(options.Token)
+	decoderSecretModel.SetValue(options.Secret)
+	decoderPassphraseModel.SetValue(options.Passphrase)
+	decoderIssuerModel.SetValue(options.Issuer)
+	decoderPolicyModel.SetValue(options.Policy)
+	if options.JWKS != nil {
+		decoderSecretModel.TextArea.Placeholder = fmt.Sprintf(PlaceholderSecretJWKS, options.JWKS.URL)
+	}
 
 	decoderHelpModel := help.New()
 
-	return BubbleTeaModel{
+	// Time claims can be shown in the chosen zone, UTC or the local zone.
+	timeZones := []*time.Location{time.Local, time.UTC}
+	if options.TimeZone != nil {
+		timeZones = slices.DeleteFunc(timeZones, func(loc *time.Location) bool { return loc.String() == options.TimeZone.String() })
+		timeZones = append([]*time.Location{options.TimeZone}, timeZones...)
+	}
+
+	m := BubbleTeaModel{
 		SelectedView:           ViewJWTDecoder,
 		FocusedElement:         ElementDecoderJWTTextArea,
 		DecoderJWTModel:        decoderJWTModel,
 		DecoderSecretModel:     decoderSecretModel,
+		DecoderPassphraseModel: decoderPassphraseModel,
 		DecoderJWTHeaderModel:  decoderHeaderModel,
 		DecoderJWTPayloadModel: decoderPayloadModel,
+		DecoderIssuerModel:     decoderIssuerModel,
+		DecoderChecksModel:     decoderChecksModel,
+		DecoderNestedModel:     decoderNestedModel,
+		DecoderAtModel:         decoderAtModel,
+		DecoderLeewayModel:     decoderLeewayModel,
+		DecoderPolicyModel:     decoderPolicyModel,
+		TimeZones:              timeZones,
+		IDToken:                options.IDToken,
+		Audience:               options.Audience,
+		Schema:                 options.Schema,
+		Rules:                  options.Rules,
+		RemoteJWKS:             options.JWKS,
 		EncoderJWTModel:        encoderJWTModel,
 		EncoderSecretModel:     encoderSecretModel,
 		EncoderJWTHeaderModel:  encoderHeaderModel,
 		EncoderJWTPayloadModel: encoderPayloadModel,
+		EncoderPassphraseModel: encoderPassphraseModel,
+		EncoderRecipientModel:  encoderRecipientModel,
 		EncodeResult:           nil,
+		InspectorJWTModel:      inspectorJWTModel,
+		InspectorSecretModel:   inspectorSecretModel,
+		InspectorFindingsModel: inspectorFindingsModel,
+		InspectorWordlistModel: inspectorWordlistModel,
 		HelpModel:              decoderHelpModel,
+
+		EncoderKeyAlgorithm:      jose.RSA_OAEP_256,
+		EncoderContentEncryption: jose.A256GCM,
+		EncoderNested:            true,
+		EncoderFixtureTokenModel: encoderFixtureTokenModel,
+		EncoderFixtureKeyModel:   encoderFixtureKeyModel,
+		EncoderFixturesModel:     encoderFixturesModel,
+
+		KeygenLengthModel:  keygenLengthModel,
+		KeygenPrivateModel: keygenPrivateModel,
+		KeygenPublicModel:  keygenPublicModel,
+		KeygenKind:         DefaultKeyKind,
+		KeygenFormat:       KeyFormatPEM,
 	}
+	m.EncoderRecipientModel.Title = m.encryptionTitle()
+	m.KeygenPrivateModel.Title = m.keygenTitle()
+
+	return m
 }
 
 type BubbleTeaModel struct {
@@ -48,21 +146,98 @@ type BubbleTeaModel struct {
 
 	DecoderJWTModel        PanelModel
 	DecoderSecretModel     PanelModel
+	DecoderPassphraseModel PanelModel
 	DecoderJWTHeaderModel  PanelModel
 	DecoderJWTPayloadModel PanelModel
-	DecodeResult           *JWTDecodeResult
+	DecoderIssuerModel     PanelModel
+	DecoderChecksModel     PanelModel
+	DecoderNestedModel     PanelModel
+	DecoderAtModel         PanelModel
+	DecoderLeewayModel     PanelModel
+	DecoderPolicyModel     PanelModel
+	IDToken                *IDTokenExpectations
+	Audience               string
+	// Policy is the policy parsed from the policy panel, nil when it is
+	// empty or invalid.
+	Policy *ValidationPolicy
+	// Schema is matched against the header and claims in both views.
+	Schema *TokenSchema
+	// Rules are evaluated against every decoded token.
+	Rules         *RuleSet
+	DecodeResult  *JWTDecodeResult
+	DecodeOptions JWTDecodeOptions
+	RemoteJWKS    *RemoteJWKS
+	FetchingJWKS  bool
+	PendingIssuer string
+	OIDCProvider  *OIDCProvider
+	OIDCError     error
+	// NestedTokens are the tokens found in the decoded token, the selected
+	// one opened by KeyOpenNestedToken. DecoderStack holds the levels above.
+	NestedTokens   []NestedToken
+	SelectedNested int
+	DecoderStack   []DecoderLevel
+	// TimeZones lists the zones time claims can be shown in, the first one
+	// being the current one.
+	TimeZones []*time.Location
 
 	EncoderJWTModel        PanelModel
 	EncoderSecretModel     PanelModel
 	EncoderJWTHeaderModel  PanelModel
 	EncoderJWTPayloadModel PanelModel
+	EncoderPassphraseModel PanelModel
+	EncoderRecipientModel  PanelModel
 	EncodeResult           *JWTEncodeResult
 
+	// JWE settings used when a recipient key is entered in the encoder.
+	EncoderKeyAlgorithm      jose.KeyAlgorithm
+	EncoderContentEncryption jose.ContentEncryption
+	EncoderNested            bool
+
+	// EncoderFixtures switches the encoder to deriving attack fixtures from
+	// a signed token and its public key.
+	EncoderFixtures          bool
+	EncoderFixtureTokenModel PanelModel
+	EncoderFixtureKeyModel   PanelModel
+	EncoderFixturesModel     PanelModel
+	Fixtures                 []AttackFixture
+	// AttackerKey signs the embedded jwk fixture, generated once in the
+	// background when fixtures are first shown.
+	AttackerKey           *rsa.PrivateKey
+	AttackerKeyErr        error
+	GeneratingAttackerKey bool
+	// FixturesFrom are the inputs Fixtures were derived from, so they are
+	// only derived again when one changes.
+	FixturesFrom fixtureInputs
+
+	InspectorJWTModel      PanelModel
+	InspectorSecretModel   PanelModel
+	InspectorFindingsModel PanelModel
+	InspectorWordlistModel PanelModel
+	Findings               []Finding
+	// Crack is the wordlist run in progress. CrackedToken and CrackedSecret
+	// remember the last secret found.
+	Crack         *CrackJob
+	CrackedToken  string
+	CrackedSecret string
+
+	KeygenLengthModel  PanelModel
+	KeygenPrivateModel PanelModel
+	KeygenPublicModel  PanelModel
+	KeygenKind         KeyKind
+	KeygenFormat       string
+	// GeneratedKey is the key shown. KeygenSeq numbers generations so that
+	// a slow RSA key does not replace one asked for after it.
+	GeneratedKey *GeneratedKey
+	KeygenSeq    int
+	// KeygenAlgorithm is the algorithm chosen for the key kind, empty for
+	// its default.
+	KeygenAlgorithm string
+
 	HelpModel help.Model
 }
 
 func (m BubbleTeaModel) Init() tea.Cmd {
-	return nil
+	return ExpiryTickCmd()
 }
 
 func (m BubbleTeaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -72,40 +247,7 @@ func (m BubbleTeaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.WindowSize = msg
-
-		headerHeight := 2
-		footerHeight := 1
-
-		styleTitle = styleTitle.Width((msg.Width / 2) - 2)
-		styleTitleSelected = styleTitleSelected.Width((msg.Width / 2) - 2)
-
-		availableHeight := msg.Height - headerHeight - footerHeight - 5
-
-		m.DecoderJWTModel.SetHeight((availableHeight / 2))
-		m.DecoderJWTModel.SetWidth((msg.Width / 2))
-
-		m.DecoderSecretModel.SetHeight((availableHeight / 2))
-		m.DecoderSecretModel.SetWidth((msg.Width / 2))
-
-		m.DecoderJWTPayloadModel.SetHeight((availableHeight / 2))
-		m.DecoderJWTPayloadModel.SetWidth((msg.Width / 2))
-
-		m.DecoderJWTHeaderModel.SetHeight((availableHeight / 2))
-		m.DecoderJWTHeaderModel.SetWidth((msg.Width / 2))
-
-		m.EncoderJWTHeaderModel.SetHeight((availableHeight / 2))
-		m.EncoderJWTHeaderModel.SetWidth((msg.Width / 2))
-
-		m.EncoderJWTPayloadModel.SetHeight((availableHeight / 2))
-		m.EncoderJWTPayloadModel.SetWidth((msg.Width / 2))
-
-		m.EncoderSecretModel.SetHeight((availableHeight / 2))
-		m.EncoderSecretModel.SetWidth((msg.Width / 2))
-
-		m.EncoderJWTModel.SetHeight((availableHeight / 2))
-		m.EncoderJWTModel.SetWidth((msg.Width / 2))
-
-		m.HelpModel.SetWidth(msg.Width)
+		m.layout()
 
 		return m, FocusElementCmd(ElementDecoderJWTTextArea)
 
@@ -115,15 +257,28 @@ func (m BubbleTeaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case KeyQuit, KeyQuitAlt:
 			return m, tea.Quit
 		case KeySwitchView:
-			if m.SelectedView == ViewJWTDecoder {
+			switch m.SelectedView {
+			case ViewJWTDecoder:
 				m.SelectedView = ViewJWTEncoder
 				m.FocusedElement = ElementEncoderHeaderTextArea
-				return m, FocusElementCmd(m.FocusedElement)
-			} else {
+				if m.EncoderFixtures {
+					m.FocusedElement = ElementEncoderFixtureTokenTextArea
+				}
+			case ViewJWTEncoder:
+				m.SelectedView = ViewInspector
+				m.FocusedElement = ElementInspectorJWTTextArea
+				m.enterInspector()
+			case ViewInspector:
+				m.SelectedView = ViewKeygen
+				m.FocusedElement = ElementKeygenLengthInput
+				if m.GeneratedKey == nil && m.KeygenSeq == 0 {
+					return m, tea.Batch(FocusElementCmd(m.FocusedElement), m.generateKey())
+				}
+			default:
 				m.SelectedView = ViewJWTDecoder
 				m.FocusedElement = ElementDecoderJWTTextArea
-				return m, FocusElementCmd(m.FocusedElement)
 			}
+			return m, FocusElementCmd(m.FocusedElement)
 		}
 
 		switch m.SelectedView {
@@ -135,14 +290,60 @@ func (m BubbleTeaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case KeyFocusSecret:
 				m.FocusedElement = ElementDecoderSecretTextArea
 				return m, FocusElementCmd(m.FocusedElement)
+			case KeyFocusPassphrase:
+				if m.ShowDecoderPassphrase() {
+					m.FocusedElement = ElementDecoderPassphraseInput
+					return m, FocusElementCmd(m.FocusedElement)
+				}
 			case KeyFocusHeader:
 				m.FocusedElement = ElementDecoderHeaderTextArea
 				return m, FocusElementCmd(m.FocusedElement)
 			case KeyFocusPayload:
 				m.FocusedElement = ElementDecoderPayloadTextArea
 				return m, FocusElementCmd(m.FocusedElement)
+			case KeyFocusIssuer:
+				m.FocusedElement = ElementDecoderIssuerInput
+				return m, FocusElementCmd(m.FocusedElement)
+			case KeyFocusAt:
+				m.FocusedElement = ElementDecoderAtInput
+				return m, FocusElementCmd(m.FocusedElement)
+			case KeyFocusLeeway:
+				m.FocusedElement = ElementDecoderLeewayInput
+				return m, FocusElementCmd(m.FocusedElement)
+			case KeyFocusPolicy:
+				m.FocusedElement = ElementDecoderPolicyTextArea
+				return m, FocusElementCmd(m.FocusedElement)
+			case KeyCycleTimeZone:
+				m.TimeZones = append(m.TimeZones[1:], m.TimeZones[0])
+				return m, tea.Batch(m.decode()...)
+			case KeyNextNestedToken:
+				return m, m.openNextNestedToken()
+			case KeyOpenNestedToken:
+				if len(m.NestedTokens) > 0 {
+					return m, m.openNestedToken()
+				}
+				return m, nil
+			case KeyCloseNestedToken:
+				if len(m.DecoderStack) > 0 {
+					return m, m.closeNestedToken()
+				}
 			}
 		case ViewJWTEncoder:
+			if keyStr == KeyToggleFixtures {
+				cmd := m.toggleFixtures()
+				return m, tea.Batch(FocusElementCmd(m.FocusedElement), cmd)
+			}
+			if m.EncoderFixtures {
+				switch keyStr {
+				case KeyFocusToken:
+					m.FocusedElement = ElementEncoderFixtureTokenTextArea
+					return m, FocusElementCmd(m.FocusedElement)
+				case KeyFocusSecret:
+					m.FocusedElement = ElementEncoderFixtureKeyTextArea
+					return m, FocusElementCmd(m.FocusedElement)
+				}
+				break
+			}
 			switch keyStr {
 			case KeyFocusHeader:
 				m.FocusedElement = ElementEncoderHeaderTextArea
@@ -156,7 +357,91 @@ func (m BubbleTeaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case KeyFocusToken:
 				m.FocusedElement = ElementEncoderJWTTextArea
 				return m, FocusElementCmd(m.FocusedElement)
+			case KeyFocusPassphrase:
+				if m.ShowEncoderPassphrase() {
+					m.FocusedElement = ElementEncoderPassphraseInput
+					return m, FocusElementCmd(m.FocusedElement)
+				}
+			case KeyFocusRecipient:
+				m.FocusedElement = ElementEncoderRecipientTextArea
+				return m, FocusElementCmd(m.FocusedElement)
+			case KeyCycleKeyAlgorithm:
+				m.EncoderKeyAlgorithm = nextKeyAlgorithm(m.EncoderKeyAlgorithm)
+				m.encode()
+				return m, nil
+			case KeyCycleContentEncryption:
+				m.EncoderContentEncryption = nextContentEncryption(m.EncoderContentEncryption)
+				m.encode()
+				return m, nil
+			case KeyToggleNested:
+				m.EncoderNested = !m.EncoderNested
+				m.encode()
+				return m, nil
 			}
+		case ViewInspector:
+			switch keyStr {
+			case KeyFocusToken:
+				m.FocusedElement = ElementInspectorJWTTextArea
+				return m, FocusElementCmd(m.FocusedElement)
+			case KeyFocusSecret:
+				m.FocusedElement = ElementInspectorSecretTextArea
+				return m, FocusElementCmd(m.FocusedElement)
+			case KeyFocusWordlist:
+				m.FocusedElement = ElementInspectorWordlistInput
+				return m, FocusElementCmd(m.FocusedElement)
+			case KeyRunCrack:
+				return m, m.startCrack()
+			}
+		case ViewKeygen:
+			switch keyStr {
+			case KeyFocusHMACLength:
+				m.FocusedElement = ElementKeygenLengthInput
+				return m, FocusElementCmd(m.FocusedElement)
+			case KeyCycleKeyKind:
+				m.KeygenKind = nextKeyKind(m.KeygenKind)
+				m.KeygenAlgorithm = ""
+				return m, m.generateKey()
+			case KeyCycleKeyAlgorithm:
+				m.cycleKeyAlgorithm()
+				return m, nil
+			case KeyCycleKeyFormat:
+				m.KeygenFormat = nextKeyFormat(m.KeygenFormat)
+				m.renderKey()
+				return m, nil
+			case KeyGenerateKey:
+				return m, m.generateKey()
+			case KeyUseKeys:
+				m.useKeys()
+				return m, nil
+			}
+		}
+	case ExpiryTickMsg:
+		// Only the time dependent parts are refreshed, the views are not
+		// re-signed or re-audited every second.
+		cmds = append(cmds, ExpiryTickCmd())
+		m.renderCrackProgress()
+		if m.SelectedView == ViewJWTDecoder {
+			cmds = append(cmds, m.refreshTimeClaims()...)
+		}
+		return m, tea.Batch(cmds...)
+	case CrackDoneMsg:
+		m.finishCrack(msg)
+	case KeyGeneratedMsg:
+		m.finishKeyGeneration(msg)
+	case AttackerKeyMsg:
+		m.GeneratingAttackerKey = false
+		m.AttackerKey, m.AttackerKeyErr = msg.Key, msg.Err
+		// Derive the fixtures again, or show the error.
+		m.FixturesFrom = fixtureInputs{}
+	case JWKSFetchedMsg:
+		m.FetchingJWKS = false
+	case DiscoverIssuerMsg:
+		if msg.Issuer == m.PendingIssuer {
+			cmds = append(cmds, DiscoverIssuerCmd(msg.Issuer))
+		}
+	case IssuerDiscoveredMsg:
+		if msg.Issuer == m.PendingIssuer {
+			m.OIDCProvider, m.OIDCError = msg.Provider, msg.Err
 		}
 	case tea.MouseReleaseMsg:
 		if msg.Button == tea.MouseLeft {
@@ -178,45 +463,59 @@ func (m BubbleTeaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.DecoderSecretModel, cmd = m.DecoderSecretModel.Update(msg)
 		cmds = append(cmds, cmd)
 
+		m.DecoderPassphraseModel, cmd = m.DecoderPassphraseModel.Update(msg)
+		cmds = append(cmds, cmd)
+
 		m.DecoderJWTHeaderModel, cmd = m.DecoderJWTHeaderModel.Update(msg)
 		cmds = append(cmds, cmd)
 
 		m.DecoderJWTPayloadModel, cmd = m.DecoderJWTPayloadModel.Update(msg)
 		cmds = append(cmds, cmd)
 
-		m.DecodeResult = nil
-		token := m.DecoderJWTModel.GetValue()
-		secret := m.DecoderSecretModel.GetValue()
+		m.DecoderIssuerModel, cmd = m.DecoderIssuerModel.Update(msg)
+		cmds = append(cmds, cmd)
 
-		if token != "" {
-			m.DecodeResult = JWTDecodeToken(token, secret)
+		m.DecoderChecksModel, cmd = m.DecoderChecksModel.Update(msg)
+		cmds = append(cmds, cmd)
 
-			if m.DecodeResult != nil {
-				if !m.DecodeResult.IsTokenValid {
-					m.DecoderJWTModel.SetError(StatusInvalidToken)
-				} else {
-					m.DecoderJWTModel.SetError("") // Clear error if valid
-				}
+		m.DecoderNestedModel, cmd = m.DecoderNestedModel.Update(msg)
+		cmds = append(cmds, cmd)
 
-				if !m.DecodeResult.IsSignatureValid {
-					m.DecoderSecretModel.SetError(StatusSignatureVerificationFailed)
-				} else {
-					m.DecoderSecretModel.SetError("") // Clear error if valid
-				}
-			}
+		m.DecoderAtModel, cmd = m.DecoderAtModel.Update(msg)
+		cmds = append(cmds, cmd)
 
-			if m.DecodeResult.Token != nil {
-				m.DecoderJWTHeaderModel.SetValue(m.DecodeResult.JsonMarshaledHeader())
-				m.DecoderJWTPayloadModel.SetValue(m.DecodeResult.JsonMarshaledClaims())
-			} else {
-				m.DecoderJWTHeaderModel.SetValue("")
-				m.DecoderJWTPayloadModel.SetValue("")
-			}
-		} else {
-			m.DecoderJWTModel.SetError("")
-			m.DecoderSecretModel.SetError("")
+		m.DecoderLeewayModel, cmd = m.DecoderLeewayModel.Update(msg)
+		cmds = append(cmds, cmd)
+
+		m.DecoderPolicyModel, cmd = m.DecoderPolicyModel.Update(msg)
+		cmds = append(cmds, cmd)
+
+		showChecks, showNested, showPassphrase := m.ShowDecoderChecks(), m.ShowDecoderNested(), m.ShowDecoderPassphrase()
+		cmds = append(cmds, m.decode()...)
+
+		// The checks panel only appears with a policy, the nested tokens
+		// panel only for tokens that contain some and the passphrase input
+		// only for encrypted private keys.
+		if showChecks != m.ShowDecoderChecks() || showNested != m.ShowDecoderNested() || showPassphrase != m.ShowDecoderPassphrase() {
+			m.layout()
 		}
 	case ViewJWTEncoder:
+		if m.EncoderFixtures {
+			m.EncoderFixtureTokenModel, cmd = m.EncoderFixtureTokenModel.Update(msg)
+			cmds = append(cmds, cmd)
+
+			m.EncoderFixtureKeyModel, cmd = m.EncoderFixtureKeyModel.Update(msg)
+			cmds = append(cmds, cmd)
+
+			m.EncoderFixturesModel, cmd = m.EncoderFixturesModel.Update(msg)
+			cmds = append(cmds, cmd)
+
+			m.generateFixtures()
+			break
+		}
+
+		showPassphrase := m.ShowEncoderPassphrase()
+
 		m.EncoderJWTHeaderModel, cmd = m.EncoderJWTHeaderModel.Update(msg)
 		cmds = append(cmds, cmd)
 
@@ -229,50 +528,132 @@ func (m BubbleTeaModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.EncoderJWTModel, cmd = m.EncoderJWTModel.Update(msg)
 		cmds = append(cmds, cmd)
 
-		var headerStr, payloadStr string
+		m.EncoderPassphraseModel, cmd = m.EncoderPassphraseModel.Update(msg)
+		cmds = append(cmds, cmd)
 
-		headerStr = m.EncoderJWTHeaderModel.GetValue()
-		payloadStr = m.EncoderJWTPayloadModel.GetValue()
+		m.EncoderRecipientModel, cmd = m.EncoderRecipientModel.Update(msg)
+		cmds = append(cmds, cmd)
 
-		secretStr := m.EncoderSecretModel.GetValue()
+		// The passphrase input only appears for encrypted private keys.
+		if showPassphrase != m.ShowEncoderPassphrase() {
+			m.layout()
+		}
 
-		var headerError, payloadError string
+		m.encode()
+	case ViewInspector:
+		m.InspectorJWTModel, cmd = m.InspectorJWTModel.Update(msg)
+		cmds = append(cmds, cmd)
 
-		var header map[string]interface{}
-		var claims jwt.MapClaims
+		m.InspectorSecretModel, cmd = m.InspectorSecretModel.Update(msg)
+		cmds = append(cmds, cmd)
 
-		if headerStr != "" {
-			if err := json.Unmarshal([]byte(headerStr), &header); err != nil {
-				headerError = "Invalid header JSON: " + err.Error()
-			}
-		}
+		m.InspectorFindingsModel, cmd = m.InspectorFindingsModel.Update(msg)
+		cmds = append(cmds, cmd)
 
-		if payloadStr != "" {
-			if err := json.Unmarshal([]byte(payloadStr), &claims); err != nil {
-				payloadError = "Invalid payload JSON: " + err.Error()
-			}
-		}
+		m.InspectorWordlistModel, cmd = m.InspectorWordlistModel.Update(msg)
+		cmds = append(cmds, cmd)
 
-		m.EncoderJWTHeaderModel.SetError(headerError)
-		m.EncoderJWTPayloadModel.SetError(payloadError)
-
-		if (headerStr != "" && headerError == "") && (payloadStr != "" && payloadError == "") {
-			m.EncodeResult = JWTEncodeToken(header, claims, secretStr)
-			m.EncoderJWTModel.SetValue(m.EncodeResult.Token)
-		} else {
-			m.EncoderJWTModel.SetValue("")
-			m.EncodeResult = &JWTEncodeResult{
-				Token:        "",
-				HeaderError:  headerError,
-				PayloadError: payloadError,
-				SigningError: "",
-			}
+		m.inspect()
+	case ViewKeygen:
+		length := m.KeygenLengthModel.GetValue()
+
+		m.KeygenLengthModel, cmd = m.KeygenLengthModel.Update(msg)
+		cmds = append(cmds, cmd)
+
+		m.KeygenPrivateModel, cmd = m.KeygenPrivateModel.Update(msg)
+		cmds = append(cmds, cmd)
+
+		m.KeygenPublicModel, cmd = m.KeygenPublicModel.Update(msg)
+		cmds = append(cmds, cmd)
+
+		// Only HMAC secrets have a length to regenerate them with.
+		if m.KeygenKind == KeyKindHMAC && length != m.KeygenLengthModel.GetValue() {
+			cmds = append(cmds, m.generateKey())
 		}
 	}
 
 	return m, tea.Batch(cmds...)
 }
 
+// layout sizes every panel to fit the current window size.
+func (m *BubbleTeaModel) layout() {
+	headerHeight := 2
+	footerHeight := 1
+
+	width := m.WindowSize.Width / 2
+
+	styleTitle = styleTitle.Width(width - 2)
+	styleTitleSelected = styleTitleSelected.Width(width - 2)
+
+	availableHeight := m.WindowSize.Height - headerHeight - footerHeight - 5
+
+	SizePanelColumn(availableHeight, width, m.decoderPane1Panels()...)
+	SizePanelColumn(availableHeight, width, m.decoderPane2Panels()...)
+
+	SizePanelColumn(availableHeight, width, &m.EncoderJWTHeaderModel, &m.EncoderJWTPayloadModel)
+	if m.ShowEncoderPassphrase() {
+		SizePanelColumn(availableHeight, width, &m.EncoderSecretModel, &m.EncoderPassphraseModel, &m.EncoderRecipientModel, &m.EncoderJWTModel)
+	} else {
+		SizePanelColumn(availableHeight, width, &m.EncoderSecretModel, &m.EncoderRecipientModel, &m.EncoderJWTModel)
+	}
+
+	SizePanelColumn(availableHeight, width, &m.EncoderFixtureTokenModel, &m.EncoderFixtureKeyModel)
+	SizePanelColumn(availableHeight, width, &m.EncoderFixturesModel)
+
+	SizePanelColumn(availableHeight, width, &m.InspectorJWTModel, &m.InspectorSecretModel, &m.InspectorWordlistModel)
+	SizePanelColumn(availableHeight, width, &m.InspectorFindingsModel)
+
+	SizePanelColumn(availableHeight, width, &m.KeygenLengthModel, &m.KeygenPrivateModel)
+	SizePanelColumn(availableHeight, width, &m.KeygenPublicModel)
+
+	m.HelpModel.SetWidth(m.WindowSize.Width)
+}
+
+// ShowDecoderChecks reports whether a validation profile is active whose
+// checklist is shown beside the decoded payload.
+func (m BubbleTeaModel) ShowDecoderChecks() bool {
+	return m.IDToken != nil || m.Policy != nil || m.Rules != nil
+}
+
+// ShowDecoderNested reports whether the nested tokens panel is shown, either
+// because the token contains some or because one is opened.
+func (m BubbleTeaModel) ShowDecoderNested() bool {
+	return len(m.NestedTokens) > 0 || len(m.DecoderStack) > 0
+}
+
+// decoderPane1Panels returns the token, key and validation setting panels.
+func (m *BubbleTeaModel) decoderPane1Panels() []*PanelModel {
+	panels := []*PanelModel{&m.DecoderJWTModel, &m.DecoderSecretModel}
+	if m.ShowDecoderPassphrase() {
+		panels = append(panels, &m.DecoderPassphraseModel)
+	}
+	return append(panels, &m.DecoderIssuerModel, &m.DecoderAtModel, &m.DecoderLeewayModel, &m.DecoderPolicyModel)
+}
+
+// decoderPane2Panels returns the panels shown beside the token and secret.
+func (m *BubbleTeaModel) decoderPane2Panels() []*PanelModel {
+	panels := []*PanelModel{&m.DecoderJWTHeaderModel, &m.DecoderJWTPayloadModel}
+	if m.ShowDecoderChecks() {
+		panels = append(panels, &m.DecoderChecksModel)
+	}
+	if m.ShowDecoderNested() {
+		panels = append(panels, &m.DecoderNestedModel)
+	}
+	return panels
+}
+
+// ShowDecoderPassphrase reports whether the decoder secret is an encrypted
+// private key that needs the passphrase input.
+func (m BubbleTeaModel) ShowDecoderPassphrase() bool {
+	return IsEncryptedPrivateKeyPEM(m.DecoderSecretModel.GetValue())
+}
+
+// ShowEncoderPassphrase reports whether the encoder secret is an encrypted
+// private key that needs the passphrase input.
+func (m BubbleTeaModel) ShowEncoderPassphrase() bool {
+	return IsEncryptedPrivateKeyPEM(m.EncoderSecretModel.GetValue())
+}
+
 func (m BubbleTeaModel) View() tea.View {
 	v := tea.View{
 		AltScreen: true,
@@ -283,48 +664,94 @@ func (m BubbleTeaModel) View() tea.View {
 
 	switch m.SelectedView {
 	case ViewJWTDecoder:
-		pane1 := lipgloss.JoinVertical(lipgloss.Left,
-			m.DecoderJWTModel.View(),
-			m.DecoderSecretModel.View(),
-		)
+		var pane1Panels []string
+		for _, panel := range m.decoderPane1Panels() {
+			pane1Panels = append(pane1Panels, panel.View())
+		}
 
-		pane2 := lipgloss.JoinVertical(lipgloss.Left,
-			m.DecoderJWTHeaderModel.View(),
-			m.DecoderJWTPayloadModel.View(),
-		)
+		pane1 := lipgloss.JoinVertical(lipgloss.Left, pane1Panels...)
+
+		var pane2Panels []string
+		for _, panel := range m.decoderPane2Panels() {
+			pane2Panels = append(pane2Panels, panel.View())
+		}
+
+		pane2 := lipgloss.JoinVertical(lipgloss.Left, pane2Panels...)
 
 		content = lipgloss.JoinHorizontal(lipgloss.Left,
 			pane1,
 			pane2,
 		)
 	case ViewJWTEncoder:
+		if m.EncoderFixtures {
+			pane1 := lipgloss.JoinVertical(lipgloss.Left,
+				m.EncoderFixtureTokenModel.View(),
+				m.EncoderFixtureKeyModel.View(),
+			)
+
+			content = lipgloss.JoinHorizontal(lipgloss.Left,
+				pane1,
+				m.EncoderFixturesModel.View(),
+			)
+			break
+		}
+
 		pane1 := lipgloss.JoinVertical(lipgloss.Left,
 			m.EncoderJWTHeaderModel.View(),
 			m.EncoderJWTPayloadModel.View(),
 		)
 
-		pane2 := lipgloss.JoinVertical(lipgloss.Left,
-			m.EncoderSecretModel.View(),
-			m.EncoderJWTModel.View(),
-		)
+		pane2Panels := []string{m.EncoderSecretModel.View()}
+		if m.ShowEncoderPassphrase() {
+			pane2Panels = append(pane2Panels, m.EncoderPassphraseModel.View())
+		}
+		pane2Panels = append(pane2Panels, m.EncoderRecipientModel.View(), m.EncoderJWTModel.View())
+
+		pane2 := lipgloss.JoinVertical(lipgloss.Left, pane2Panels...)
 
 		content = lipgloss.JoinHorizontal(lipgloss.Left,
 			pane1,
 			pane2,
 		)
+	case ViewInspector:
+		pane1 := lipgloss.JoinVertical(lipgloss.Left,
+			m.InspectorJWTModel.View(),
+			m.InspectorSecretModel.View(),
+			m.InspectorWordlistModel.View(),
+		)
+
+		content = lipgloss.JoinHorizontal(lipgloss.Left,
+			pane1,
+			m.InspectorFindingsModel.View(),
+		)
+	case ViewKeygen:
+		pane1 := lipgloss.JoinVertical(lipgloss.Left,
+			m.KeygenLengthModel.View(),
+			m.KeygenPrivateModel.View(),
+		)
+
+		content = lipgloss.JoinHorizontal(lipgloss.Left,
+			pane1,
+			m.KeygenPublicModel.View(),
+		)
 	}
 
-	decoderStyle, encoderStyle := styleInactiveScreen, styleInactiveScreen
+	decoderStyle, encoderStyle, inspectorStyle, keygenStyle := styleInactiveScreen, styleInactiveScreen, styleInactiveScreen, styleInactiveScreen
 
 	switch m.SelectedView {
 	case ViewJWTDecoder:
 		decoderStyle = styleActiveScreen
 	case ViewJWTEncoder:
 		encoderStyle = styleActiveScreen
+	case ViewInspector:
+		inspectorStyle = styleActiveScreen
+	case ViewKeygen:
+		keygenStyle = styleActiveScreen
 	}
 
 	header := styleHeader.Width(m.WindowSize.Width).
-		Render(decoderStyle.Render(TitleDecoder) + styleInactiveScreen.Render(" | ") + encoderStyle.Render(TitleEncoder))
+		Render(decoderStyle.Render(TitleDecoder) + styleInactiveScreen.Render(" | ") + encoderStyle.Render(TitleEncoder) +
+			styleInactiveScreen.Render(" | ") + inspectorStyle.Render(TitleInspector) + styleInactiveScreen.Render(" | ") + keygenStyle.Render(TitleKeygen))
 
 	footer := lipgloss.NewStyle().Padding(0, 1, 0, 1).MarginTop(1).Render(m.HelpModel.View(m))
 
@@ -342,14 +769,55 @@ func (m BubbleTeaModel) View() tea.View {
 func (m BubbleTeaModel) ShortHelp() []key.Binding {
 	switch m.SelectedView {
 	case ViewJWTDecoder:
-		return []key.Binding{
+		bindings := []key.Binding{
 			key.NewBinding(key.WithKeys(KeyQuit, KeyQuitAlt), key.WithHelp(KeyQuit, "Quit")),
 			key.NewBinding(key.WithKeys(KeySwitchView), key.WithHelp(KeySwitchView, "Switch to Encoder")),
 		}
+		if len(m.NestedTokens) > 0 {
+			bindings = append(bindings, key.NewBinding(key.WithKeys(KeyOpenNestedToken), key.WithHelp(KeyOpenNestedToken, "Open nested token")))
+		}
+		if len(m.NestedTokens) > 0 || len(m.DecoderStack) > 0 {
+			bindings = append(bindings, key.NewBinding(key.WithKeys(KeyNextNestedToken), key.WithHelp(KeyNextNestedToken, "Next nested token")))
+		}
+		if len(m.DecoderStack) > 0 {
+			bindings = append(bindings, key.NewBinding(key.WithKeys(KeyCloseNestedToken), key.WithHelp(KeyCloseNestedToken, "Back to outer token")))
+		}
+		return bindings
 	case ViewJWTEncoder:
+		if m.EncoderFixtures {
+			return []key.Binding{
+				key.NewBinding(key.WithKeys(KeyQuit, KeyQuitAlt), key.WithHelp(KeyQuit, "Quit")),
+				key.NewBinding(key.WithKeys(KeySwitchView), key.WithHelp(KeySwitchView, "Switch to Inspector")),
+				key.NewBinding(key.WithKeys(KeyToggleFixtures), key.WithHelp(KeyToggleFixtures, "Back to encoder")),
+			}
+		}
+		return []key.Binding{
+			key.NewBinding(key.WithKeys(KeyQuit, KeyQuitAlt), key.WithHelp(KeyQuit, "Quit")),
+			key.NewBinding(key.WithKeys(KeySwitchView), key.WithHelp(KeySwitchView, "Switch to Inspector")),
+			key.NewBinding(key.WithKeys(KeyToggleFixtures), key.WithHelp(KeyToggleFixtures, "Attack fixtures")),
+			key.NewBinding(key.WithKeys(KeyCycleKeyAlgorithm), key.WithHelp(KeyCycleKeyAlgorithm, "JWE alg")),
+			key.NewBinding(key.WithKeys(KeyCycleContentEncryption), key.WithHelp(KeyCycleContentEncryption, "JWE enc")),
+			key.NewBinding(key.WithKeys(KeyToggleNested), key.WithHelp(KeyToggleNested, "Nested JWT / claims")),
+		}
+	case ViewInspector:
+		crackHelp := "Test secret against wordlist"
+		if m.Crack != nil {
+			crackHelp = "Stop wordlist test"
+		}
+		return []key.Binding{
+			key.NewBinding(key.WithKeys(KeyQuit, KeyQuitAlt), key.WithHelp(KeyQuit, "Quit")),
+			key.NewBinding(key.WithKeys(KeySwitchView), key.WithHelp(KeySwitchView, "Switch to Key Generator")),
+			key.NewBinding(key.WithKeys(KeyRunCrack), key.WithHelp(KeyRunCrack, crackHelp)),
+		}
+	case ViewKeygen:
 		return []key.Binding{
 			key.NewBinding(key.WithKeys(KeyQuit, KeyQuitAlt), key.WithHelp(KeyQuit, "Quit")),
 			key.NewBinding(key.WithKeys(KeySwitchView), key.WithHelp(KeySwitchView, "Switch to Decoder")),
+			key.NewBinding(key.WithKeys(KeyCycleKeyKind), key.WithHelp(KeyCycleKeyKind, "Key type")),
+			key.NewBinding(key.WithKeys(KeyCycleKeyAlgorithm), key.WithHelp(KeyCycleKeyAlgorithm, "Algorithm")),
+			key.NewBinding(key.WithKeys(KeyCycleKeyFormat), key.WithHelp(KeyCycleKeyFormat, "PEM / JWK")),
+			key.NewBinding(key.WithKeys(KeyGenerateKey), key.WithHelp(KeyGenerateKey, "New key")),
+			key.NewBinding(key.WithKeys(KeyUseKeys), key.WithHelp(KeyUseKeys, "Use in encoder and decoder")),
 		}
 	}
 
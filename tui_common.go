@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"crypto/rsa"
 	"image/color"
+	"time"
 
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
@@ -10,9 +13,21 @@ import (
 type View string
 type Element string
 
+// DecoderLevel is a token the decoder drilled out of, restored when going
+// back up the tree of nested tokens.
+type DecoderLevel struct {
+	// Path locates the nested token that was opened from this level.
+	Path       string
+	Token      string
+	Secret     string
+	Passphrase string
+}
+
 const (
 	ViewJWTEncoder View = "jwt_encoder"
 	ViewJWTDecoder View = "jwt_decoder"
+	ViewInspector  View = "inspector"
+	ViewKeygen     View = "keygen"
 
 	ElementDecoderJWTTextArea     Element = "decoder-jwt-token"
 	ElementDecoderSecretTextArea  Element = "decoder-secret-text-area"
@@ -22,7 +37,52 @@ const (
 	ElementEncoderPayloadTextArea Element = "encoder-payload-text-area"
 	ElementEncoderSecretTextArea  Element = "encoder-secret-text-area"
 	ElementEncoderJWTTextArea     Element = "encoder-jwt-token"
+	ElementEncoderPassphraseInput Element = "encoder-passphrase-input"
+	ElementDecoderPassphraseInput Element = "decoder-passphrase-input"
+	ElementDecoderIssuerInput     Element = "decoder-issuer-input"
+	ElementDecoderChecksView      Element = "decoder-checks-view"
+	ElementDecoderNestedView      Element = "decoder-nested-view"
+	ElementDecoderAtInput         Element = "decoder-at-input"
+	ElementDecoderLeewayInput     Element = "decoder-leeway-input"
+	ElementDecoderPolicyTextArea  Element = "decoder-policy-text-area"
+
+	ElementInspectorJWTTextArea    Element = "inspector-jwt-token"
+	ElementInspectorSecretTextArea Element = "inspector-secret-text-area"
+	ElementInspectorFindingsView   Element = "inspector-findings-view"
+	ElementInspectorWordlistInput  Element = "inspector-wordlist-input"
+
+	ElementEncoderRecipientTextArea Element = "encoder-recipient-text-area"
 
+	ElementEncoderFixtureTokenTextArea Element = "encoder-fixture-token-text-area"
+	ElementEncoderFixtureKeyTextArea   Element = "encoder-fixture-key-text-area"
+	ElementEncoderFixturesView         Element = "encoder-fixtures-view"
+
+	ElementKeygenLengthInput Element = "keygen-length-input"
+	ElementKeygenPrivateView Element = "keygen-private-view"
+	ElementKeygenPublicView  Element = "keygen-public-view"
+
+	// Keys are handled before the focused panel sees them. Apart from ctrl+h
+	// and ctrl+p they stay clear of the textarea and textinput editing keys
+	// (ctrl+a, b, d, e, f, k, n, t, u, v and w). The token, key, header,
+	// payload and passphrase keys focus the same kind of panel in every view
+	// that has one, the other keys depend on the view:
+	//
+	//	key     decoder      encoder          fixtures  inspector  keygen
+	//	ctrl+j  token        token            token     token
+	//	ctrl+s  secret       secret           key       secret
+	//	ctrl+h  header       header
+	//	ctrl+p  payload      payload
+	//	ctrl+z  passphrase   passphrase
+	//	ctrl+o  issuer       recipient                             PEM / JWK
+	//	ctrl+r  evaluate at                             run        new key
+	//	ctrl+l  leeway       JWE enc                    wordlist   HMAC length
+	//	ctrl+g  policy       JWE alg                               alg
+	//	ctrl+y  time zone    nested / claims                       key type
+	//	ctrl+x  next nested  fixtures         encoder              use keys
+	//	ctrl+]  open nested
+	//	esc     back
+	//
+	// ctrl+\ switches the view and ctrl+c or ctrl+q quit in all of them.
 	KeyQuit         = "ctrl+c"
 	KeyQuitAlt      = "ctrl+q"
 	KeyFocusToken   = "ctrl+j"
@@ -31,14 +91,91 @@ const (
 	KeyFocusPayload = "ctrl+p"
 	KeySwitchView   = "ctrl+\\"
 
+	KeyFocusPassphrase = "ctrl+z"
+	KeyFocusIssuer     = "ctrl+o"
+	KeyFocusRecipient  = "ctrl+o"
+	KeyFocusAt         = "ctrl+r"
+	KeyFocusLeeway     = "ctrl+l"
+	KeyFocusPolicy     = "ctrl+g"
+
+	KeyCycleKeyAlgorithm      = "ctrl+g"
+	KeyCycleContentEncryption = "ctrl+l"
+	KeyToggleNested           = "ctrl+y"
+	KeyToggleFixtures         = "ctrl+x"
+
+	KeyCycleTimeZone = "ctrl+y"
+
+	KeyFocusWordlist = "ctrl+l"
+	KeyRunCrack      = "ctrl+r"
+
+	KeyFocusHMACLength = "ctrl+l"
+	KeyCycleKeyKind    = "ctrl+y"
+	KeyCycleKeyFormat  = "ctrl+o"
+	KeyGenerateKey     = "ctrl+r"
+	KeyUseKeys         = "ctrl+x"
+
+	KeyNextNestedToken  = "ctrl+x"
+	KeyOpenNestedToken  = "ctrl+]"
+	KeyCloseNestedToken = "esc"
+
 	StatusValidJWT                    = "Valid JWT"
 	StatusInvalidToken                = "Invalid token"
 	StatusSignatureVerified           = "Signature Verified"
 	StatusSignatureVerificationFailed = "Signature verification failed"
+	StatusSignatureUnverifiable       = "Signature could not be verified"
+	StatusTokenExpired                = "Token has expired"
+	StatusTokenNotValidYet            = "Token is not valid yet"
+	StatusTokenIssuedInFuture         = "Token was issued in the future"
+	StatusInvalidAudience             = "Token has an invalid audience"
+	StatusInvalidIssuer               = "Token has an invalid issuer"
+	StatusInvalidClaims               = "Token has invalid claims"
+	StatusFetchingJWKS                = "Fetching JWKS..."
+	StatusAlgNotAllowed               = "Algorithm is not allowed"
+	StatusIDTokenInvalid              = "ID token checks failed"
+	StatusPolicyFailed                = "Policy checks failed"
+	StatusSchemaInvalid               = "Token does not match the schema"
+	StatusRulesFailed                 = "Rules failed"
+	StatusNoFindings                  = "No findings"
+	StatusFindings                    = "%d high, %d medium, %d low"
+	StatusCrackFound                  = "Secret found: %s"
+	StatusCrackNotFound               = "Secret not found in %d candidates"
+	StatusCrackCancelled              = "Cancelled after %d candidates"
+	StatusDiscoveringIssuer           = "Discovering issuer..."
+	StatusIssuerDiscovered            = "Discovered %s"
+	StatusDecrypted                   = "Decrypted"
+	StatusDecryptionFailed            = "Decryption failed"
+	StatusUndecryptable               = "Token could not be decrypted"
+	StatusUnsigned                    = "Token is encrypted but not signed"
+	StatusSharedKey                   = "Authenticated by the shared key"
+	StatusNoNestedTokens              = "No nested tokens"
+	StatusTokenCountdown              = "Token %s"
+	StatusEvaluatingAt                = "Evaluating at %s"
+	StatusLeeway                      = "Allowing %s of clock skew"
+	StatusPolicyChecks                = "%d of %d checks passed"
+	StatusFixtures                    = "%d fixtures"
+	StatusGeneratingAttackerKey       = "Generating the attacker key..."
+	StatusGeneratingKey               = "Generating %s key..."
+	StatusKeyID                       = "alg %s, kid %s"
+	StatusHMACPublicKey               = "HMAC secrets both sign and verify"
+	StatusKeysUsed                    = "Set as the encoder and decoder secrets"
 
 	PlaceholderJWT    = "Enter the JSON Web Token (JWT) here..."
 	PlaceholderSecret = "Enter Secret"
 
+	PlaceholderSecretJWKS = "Enter Secret, or leave empty to verify with the JWKS at %s"
+
+	PlaceholderPassphrase      = "Enter the private key passphrase"
+	PlaceholderIssuer          = "Enter an OpenID Connect issuer URL to verify against"
+	PlaceholderAt              = "Now, or a time such as 2024-05-01 13:45:00"
+	PlaceholderLeeway          = "No clock skew, or a duration such as 30s"
+	PlaceholderPolicy          = `Enter a policy such as {"issuers": ["https://accounts.example.com"], "required_claims": ["sub"]}`
+	PlaceholderWordlist        = "Path of a wordlist to test the HMAC secret against"
+	PlaceholderInspectorSecret = "Enter the HMAC secret to also check its strength"
+	PlaceholderFixtureToken    = "Enter a legitimately signed token to derive attack fixtures from"
+	PlaceholderFixtureKey      = "Enter the token's public key as PEM or a JWK to add HMAC key confusion variants"
+	PlaceholderHMACLength      = "Length in characters, 64 by default"
+	PlaceholderRecipient       = "Enter a recipient public key, JWK or symmetric key to encrypt the token as a JWE"
+
 	TitleJWTToken       = "JSON WEB TOKEN (ctrl+j)"
 	TitleSecret         = "SECRET (ctrl+s)"
 	TitleDecodedHeader  = "DECODED HEADER (ctrl+h)"
@@ -47,6 +184,27 @@ const (
 	TitleEncoderPayload = "PAYLOAD (ctrl+p)"
 	TitleDecoder        = "JWT Decoder"
 	TitleEncoder        = "JWT Encoder"
+	TitleInspector      = "JWT Inspector"
+	TitleFindings       = "FINDINGS"
+	TitleWordlist       = "WORDLIST (ctrl+l, ctrl+r run)"
+	TitlePassphrase     = "PASSPHRASE (ctrl+z)"
+	TitleIssuer         = "ISSUER (ctrl+o)"
+	TitleChecks         = "CHECKS"
+	TitleRecipient      = "RECIPIENT (ctrl+o)"
+	TitleAt             = "EVALUATE AT (ctrl+r)"
+	TitleLeeway         = "LEEWAY (ctrl+l)"
+	TitlePolicy         = "POLICY (ctrl+g)"
+	TitleFixtureToken   = "SIGNED TOKEN (ctrl+j)"
+	TitleFixtureKey     = "PUBLIC KEY (ctrl+s)"
+	TitleFixtures       = "ATTACK FIXTURES (ctrl+x back to encoder)"
+	TitleKeygen         = "Key Generator"
+	TitleHMACLength     = "HMAC SECRET LENGTH (ctrl+l)"
+	TitlePrivateKey     = "PRIVATE KEY (ctrl+y type, ctrl+g alg, ctrl+o format)"
+	TitlePublicKey      = "PUBLIC KEY (ctrl+x use, ctrl+r new)"
+	TitleNestedTokens   = "NESTED TOKENS (ctrl+x next, ctrl+] open, esc back)"
+
+	EncryptionModeNested = "nested JWT"
+	EncryptionModeClaims = "claims"
 )
 
 var (
@@ -60,6 +218,46 @@ var (
 		ElementEncoderPayloadTextArea,
 		ElementEncoderSecretTextArea,
 		ElementEncoderJWTTextArea,
+		ElementEncoderPassphraseInput,
+		ElementDecoderPassphraseInput,
+		ElementDecoderIssuerInput,
+		ElementDecoderChecksView,
+		ElementEncoderRecipientTextArea,
+		ElementDecoderNestedView,
+		ElementDecoderAtInput,
+		ElementDecoderLeewayInput,
+		ElementDecoderPolicyTextArea,
+		ElementInspectorJWTTextArea,
+		ElementInspectorSecretTextArea,
+		ElementInspectorFindingsView,
+		ElementInspectorWordlistInput,
+		ElementEncoderFixtureTokenTextArea,
+		ElementEncoderFixtureKeyTextArea,
+		ElementEncoderFixturesView,
+		ElementKeygenLengthInput,
+		ElementKeygenPrivateView,
+		ElementKeygenPublicView,
+	}
+
+	// Status message shown for each decoding issue
+	IssueStatuses = map[JWTIssue]string{
+		IssueMalformed:        StatusInvalidToken,
+		IssueUnverifiable:     StatusSignatureUnverifiable,
+		IssueSignatureInvalid: StatusSignatureVerificationFailed,
+		IssueExpired:          StatusTokenExpired,
+		IssueNotValidYet:      StatusTokenNotValidYet,
+		IssueIssuedInFuture:   StatusTokenIssuedInFuture,
+		IssueInvalidAudience:  StatusInvalidAudience,
+		IssueInvalidIssuer:    StatusInvalidIssuer,
+		IssueInvalidClaims:    StatusInvalidClaims,
+		IssueAlgNotAllowed:    StatusAlgNotAllowed,
+		IssueIDTokenInvalid:   StatusIDTokenInvalid,
+		IssueUndecryptable:    StatusUndecryptable,
+		IssueDecryptionFailed: StatusDecryptionFailed,
+		IssueUnsigned:         StatusUnsigned,
+		IssuePolicyFailed:     StatusPolicyFailed,
+		IssueSchemaInvalid:    StatusSchemaInvalid,
+		IssueRulesFailed:      StatusRulesFailed,
 	}
 
 	styleTitle = lipgloss.NewStyle().
@@ -125,3 +323,96 @@ func FocusElementCmd(element Element) tea.Cmd {
 		return FocusElementMsg{Element: element}
 	}
 }
+
+// JWKSFetchedMsg is sent once a remote JWK Set fetch finishes
+type JWKSFetchedMsg struct {
+	Err error
+}
+
+// FetchJWKSCmd refreshes the remote JWK Set in the background
+func FetchJWKSCmd(jwks *RemoteJWKS) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		return JWKSFetchedMsg{Err: jwks.Refresh(ctx)}
+	}
+}
+
+// DiscoverIssuerMsg starts OIDC discovery once the issuer input settles
+type DiscoverIssuerMsg struct {
+	Issuer string
+}
+
+// IssuerDiscoveredMsg carries the result of OIDC discovery
+type IssuerDiscoveredMsg struct {
+	Issuer   string
+	Provider *OIDCProvider
+	Err      error
+}
+
+// CrackDoneMsg is sent once a wordlist has been tried against a token
+type CrackDoneMsg struct {
+	Job    *CrackJob
+	Result CrackResult
+	Err    error
+}
+
+// KeyGeneratedMsg carries a key generated in the background
+type KeyGeneratedMsg struct {
+	// Seq numbers the generation so that only the latest one is shown.
+	Seq int
+	Key *GeneratedKey
+	Err error
+}
+
+// GenerateKeyCmd generates a key in the background, RSA keys taking a while
+func GenerateKeyCmd(seq int, kind KeyKind, hmacLength int) tea.Cmd {
+	return func() tea.Msg {
+		key, err := GenerateKey(kind, hmacLength)
+		return KeyGeneratedMsg{Seq: seq, Key: key, Err: err}
+	}
+}
+
+// AttackerKeyMsg carries the attacker key generated for the fixtures
+type AttackerKeyMsg struct {
+	Key *rsa.PrivateKey
+	Err error
+}
+
+// GenerateAttackerKeyCmd generates the fixtures attacker key in the background
+func GenerateAttackerKeyCmd() tea.Cmd {
+	return func() tea.Msg {
+		key, err := GenerateAttackerKey()
+		return AttackerKeyMsg{Key: key, Err: err}
+	}
+}
+
+// ExpiryTickMsg refreshes the time claims and the expiry countdown
+type ExpiryTickMsg time.Time
+
+// ExpiryTickCmd ticks once a second to keep the countdown live
+func ExpiryTickCmd() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return ExpiryTickMsg(t)
+	})
+}
+
+// DiscoverIssuerAfterCmd waits for the user to stop typing the issuer
+// before asking for discovery
+func DiscoverIssuerAfterCmd(issuer string) tea.Cmd {
+	return tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg {
+		return DiscoverIssuerMsg{Issuer: issuer}
+	})
+}
+
+// DiscoverIssuerCmd fetches the issuer's OIDC discovery document
+func DiscoverIssuerCmd(issuer string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		provider, err := DiscoverOIDCProvider(ctx, issuer, nil)
+		return IssuerDiscoveredMsg{Issuer: issuer, Provider: provider, Err: err}
+	}
+}
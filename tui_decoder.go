@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// decode verifies the token in the decoder and updates every decoder panel
+// with the result. It returns commands for any background fetches needed.
+func (m *BubbleTeaModel) decode() []tea.Cmd {
+	var cmds []tea.Cmd
+
+	issuer := strings.TrimSpace(m.DecoderIssuerModel.GetValue())
+	if issuer != m.PendingIssuer {
+		m.PendingIssuer = issuer
+		m.OIDCProvider, m.OIDCError = nil, nil
+		if issuer != "" {
+			cmds = append(cmds, DiscoverIssuerAfterCmd(issuer))
+		}
+	}
+
+	switch {
+	case issuer == "":
+		m.DecoderIssuerModel.SetError("")
+		m.DecoderIssuerModel.SetStatus("")
+	case m.OIDCError != nil:
+		m.DecoderIssuerModel.SetError(m.OIDCError.Error())
+	case m.OIDCProvider != nil:
+		m.DecoderIssuerModel.SetError("")
+		m.DecoderIssuerModel.SetStatus(fmt.Sprintf(StatusIssuerDiscovered, m.OIDCProvider.Metadata.JWKSURI))
+	default:
+		m.DecoderIssuerModel.SetError("")
+		m.DecoderIssuerModel.SetStatus(StatusDiscoveringIssuer)
+	}
+
+	m.DecoderJWTPayloadModel.Title = fmt.Sprintf("%s %s (%s)", TitleDecodedPayload, m.TimeZones[0], KeyCycleTimeZone)
+
+	at, err := ParseEvaluationTime(m.DecoderAtModel.GetValue(), m.TimeZones[0])
+	switch {
+	case err != nil:
+		m.DecoderAtModel.SetError(err.Error())
+	case !at.IsZero():
+		m.DecoderAtModel.SetError("")
+		m.DecoderAtModel.SetStatus(fmt.Sprintf(StatusEvaluatingAt, at.In(m.TimeZones[0]).Format(TimeClaimFormat)))
+	default:
+		m.DecoderAtModel.SetError("")
+		m.DecoderAtModel.SetStatus("")
+	}
+
+	leeway, err := ParseLeeway(m.DecoderLeewayModel.GetValue())
+	switch {
+	case err != nil:
+		m.DecoderLeewayModel.SetError(err.Error())
+	case leeway > 0:
+		m.DecoderLeewayModel.SetError("")
+		m.DecoderLeewayModel.SetStatus(fmt.Sprintf(StatusLeeway, leeway))
+	default:
+		m.DecoderLeewayModel.SetError("")
+		m.DecoderLeewayModel.SetStatus("")
+	}
+
+	m.Policy = nil
+	if policyJSON := strings.TrimSpace(m.DecoderPolicyModel.GetValue()); policyJSON != "" {
+		policy, err := ParsePolicy([]byte(policyJSON))
+		if err != nil {
+			m.DecoderPolicyModel.SetError(err.Error())
+		} else {
+			m.DecoderPolicyModel.SetError("")
+			if !policy.IsZero() {
+				m.Policy = policy
+			}
+		}
+	} else {
+		m.DecoderPolicyModel.SetError("")
+	}
+	m.DecoderPolicyModel.SetStatus("")
+
+	m.DecodeResult = nil
+	token := m.DecoderJWTModel.GetValue()
+	secret := m.DecoderSecretModel.GetValue()
+
+	if token == "" {
+		m.NestedTokens = nil
+		m.renderNestedTokens()
+		m.DecoderChecksModel.SetValue("")
+		m.DecoderChecksModel.SetError("")
+		m.DecoderJWTPayloadModel.SetError("")
+		m.DecoderJWTModel.SetError("")
+		m.DecoderJWTModel.SetStatus("")
+		m.DecoderSecretModel.SetError("")
+		m.DecoderSecretModel.SetStatus("")
+		return cmds
+	}
+
+	options := JWTDecodeOptions{Secret: secret, Passphrase: m.DecoderPassphraseModel.GetValue(), Issuer: issuer, Audience: m.Audience, IDToken: m.IDToken, At: at, Leeway: leeway, Policy: m.Policy, Schema: m.Schema, Rules: m.Rules}
+
+	remoteJWKS := m.RemoteJWKS
+	if m.OIDCProvider != nil {
+		options = m.OIDCProvider.DecodeOptions(options)
+		remoteJWKS = m.OIDCProvider.JWKS
+	}
+
+	// The secret decrypts a JWE, the key set verifies the token nested in it.
+	useRemoteJWKS := remoteJWKS != nil && (secret == "" || IsJWECompact(token))
+	if useRemoteJWKS {
+		set, stale := remoteJWKS.Cached(TokenKeyID(token))
+		options.KeySet = set
+		if stale && !m.FetchingJWKS {
+			m.FetchingJWKS = true
+			cmds = append(cmds, FetchJWKSCmd(remoteJWKS))
+		}
+	}
+
+	m.DecodeResult = JWTDecodeToken(token, options)
+	m.DecodeOptions = options
+	m.renderTimeClaims(options.Now())
+
+	algorithm := m.DecodeResult.Algorithm
+	if m.DecodeResult.Encrypted {
+		algorithm = fmt.Sprintf("%s, %s", algorithm, m.DecodeResult.Encryption)
+	}
+
+	// A JWE is decrypted with the secret and authenticated by the signature
+	// of its nested token, both are reported.
+	decrypted := ""
+	if m.DecodeResult.IsDecrypted() && m.DecodeResult.KeyID != "" {
+		decrypted = fmt.Sprintf("%s (%s, kid %s)", StatusDecrypted, algorithm, m.DecodeResult.KeyID)
+	} else if m.DecodeResult.IsDecrypted() {
+		decrypted = fmt.Sprintf("%s (%s)", StatusDecrypted, algorithm)
+	}
+
+	signature := m.DecodeResult
+	if m.DecodeResult.Encrypted {
+		signature = m.DecodeResult.Signed
+	}
+	signatureAlgorithm := m.DecodeResult.SignatureAlgorithm()
+
+	var secretError string
+	switch {
+	case m.DecodeResult.KeyError != nil:
+		secretError = m.DecodeResult.KeyError.Error()
+	case m.DecodeResult.Has(IssueDecryptionFailed):
+		secretError = fmt.Sprintf("%s (%s)", StatusDecryptionFailed, algorithm)
+	case m.DecodeResult.Has(IssueUnsigned):
+		secretError = StatusUnsigned
+	case signature != nil && signature.KeyError != nil:
+		secretError = signature.KeyError.Error()
+	case m.DecodeResult.Has(IssueSignatureInvalid), m.DecodeResult.Has(IssueUnverifiable):
+		secretError = StatusSignatureVerificationFailed
+		if m.DecodeResult.Has(IssueUnverifiable) {
+			secretError = StatusSignatureUnverifiable
+		}
+		if signatureAlgorithm != "" {
+			secretError = fmt.Sprintf("%s (%s)", secretError, signatureAlgorithm)
+		}
+	case !m.DecodeResult.IsTokenValid():
+		secretError = StatusSignatureVerificationFailed
+	}
+	if secretError != "" && decrypted != "" {
+		secretError = fmt.Sprintf("%s, %s", decrypted, secretError)
+	}
+	m.DecoderSecretModel.SetError(secretError)
+
+	var verified string
+	if m.DecodeResult.IsSignatureValid() && signature == nil {
+		verified = StatusSharedKey
+	} else if m.DecodeResult.IsSignatureValid() && signature.KeyID != "" {
+		verified = fmt.Sprintf("%s (%s, kid %s)", StatusSignatureVerified, signatureAlgorithm, signature.KeyID)
+	} else if m.DecodeResult.IsSignatureValid() {
+		verified = fmt.Sprintf("%s (%s)", StatusSignatureVerified, signatureAlgorithm)
+	}
+	if decrypted != "" && verified != "" {
+		verified = fmt.Sprintf("%s, %s", decrypted, verified)
+	}
+	m.DecoderSecretModel.SetStatus(verified)
+
+	// Without a key set yet the key errors above are meaningless.
+	if useRemoteJWKS && options.KeySet == nil {
+		if err := remoteJWKS.Err(); err != nil && !m.FetchingJWKS {
+			m.DecoderSecretModel.SetError(err.Error())
+		} else {
+			m.DecoderSecretModel.SetError("")
+			m.DecoderSecretModel.SetStatus(StatusFetchingJWKS)
+		}
+	}
+
+	m.DecoderChecksModel.SetValue(FormatChecks(m.DecodeResult.Checks))
+	if m.Policy != nil {
+		checks := ValidatePolicy(m.DecodeResult, *m.Policy)
+		passed := len(slices.DeleteFunc(slices.Clone(checks), func(c JWTCheck) bool { return !c.Passed }))
+		m.DecoderPolicyModel.SetStatus(fmt.Sprintf(StatusPolicyChecks, passed, len(checks)))
+	}
+	var checksFailed []string
+	for _, issue := range []JWTIssue{IssueIDTokenInvalid, IssueRulesFailed} {
+		if m.DecodeResult.Has(issue) {
+			checksFailed = append(checksFailed, IssueStatuses[issue])
+		}
+	}
+	if len(checksFailed) == 0 && slices.ContainsFunc(m.DecodeResult.Checks, func(c JWTCheck) bool { return !c.Passed }) {
+		checksFailed = append(checksFailed, StatusPolicyFailed)
+	}
+	m.DecoderChecksModel.SetError(strings.Join(checksFailed, ", "))
+
+	m.NestedTokens = FindNestedTokens(m.DecodeResult)
+	if m.SelectedNested >= len(m.NestedTokens) {
+		m.SelectedNested = 0
+	}
+	m.renderNestedTokens()
+
+	if m.DecodeResult.Token != nil {
+		m.DecoderJWTHeaderModel.SetValue(m.DecodeResult.JsonMarshaledHeader())
+	} else {
+		m.DecoderJWTHeaderModel.SetValue("")
+	}
+	m.DecoderJWTPayloadModel.SetError(FormatSchemaViolations(m.DecodeResult.SchemaViolations))
+
+	return cmds
+}
+
+// renderTimeClaims shows the token status with the expiry countdown and the
+// payload with its time claims described relative to now.
+func (m *BubbleTeaModel) renderTimeClaims(now time.Time) {
+	var tokenErrors []string
+	if !m.DecodeResult.IsTokenValid() {
+		tokenErrors = append(tokenErrors, StatusInvalidToken)
+	}
+	for _, issue := range m.DecodeResult.TokenIssues() {
+		if countdown, expired := ExpiryCountdown(m.DecodeResult.Token, now); issue == IssueExpired && expired {
+			tokenErrors = append(tokenErrors, fmt.Sprintf(StatusTokenCountdown, countdown))
+			continue
+		}
+		tokenErrors = append(tokenErrors, IssueStatuses[issue])
+	}
+
+	m.DecoderJWTModel.SetError(strings.Join(tokenErrors, ", "))
+	if countdown, _ := ExpiryCountdown(m.DecodeResult.Token, now); len(tokenErrors) == 0 && countdown != "" {
+		m.DecoderJWTModel.SetStatus(fmt.Sprintf("%s, %s", StatusValidJWT, countdown))
+	} else if len(tokenErrors) == 0 {
+		m.DecoderJWTModel.SetStatus(StatusValidJWT)
+	} else {
+		m.DecoderJWTModel.SetStatus("")
+	}
+
+	if m.DecodeResult.Token != nil {
+		m.DecoderJWTPayloadModel.SetValue(AnnotateTimeClaims(m.DecodeResult.JsonMarshaledClaims(), now, m.TimeZones[0]))
+	} else {
+		m.DecoderJWTPayloadModel.SetValue("")
+	}
+}
+
+// refreshTimeClaims updates the countdown and time claims of the decoded
+// token every tick. The token is only decoded again when the passing time
+// changes whether it is expired or valid yet.
+func (m *BubbleTeaModel) refreshTimeClaims() []tea.Cmd {
+	// Evaluated at a fixed instant, nothing changes.
+	if m.DecodeResult == nil || !m.DecodeOptions.At.IsZero() {
+		return nil
+	}
+
+	if token := m.DecodeResult.Token; token != nil && token.Claims != nil {
+		err := jwt.NewValidator(claimsParserOptions(m.DecodeOptions)...).Validate(token.Claims)
+		issues := classifyClaimsError(err)
+		for _, issue := range []JWTIssue{IssueExpired, IssueNotValidYet, IssueIssuedInFuture} {
+			if slices.Contains(issues, issue) != m.DecodeResult.Has(issue) {
+				return m.decode()
+			}
+		}
+	}
+
+	m.renderTimeClaims(time.Now())
+	return nil
+}
+
+// openNestedToken decodes the selected nested token in place of the current
+// one, remembering the current token and key so they can be restored.
+func (m *BubbleTeaModel) openNestedToken() tea.Cmd {
+	nested := m.NestedTokens[m.SelectedNested]
+
+	m.DecoderStack = append(m.DecoderStack, DecoderLevel{
+		Path:       nested.Path,
+		Token:      m.DecoderJWTModel.GetValue(),
+		Secret:     m.DecoderSecretModel.GetValue(),
+		Passphrase: m.DecoderPassphraseModel.GetValue(),
+	})
+
+	// Each level is verified with its own key.
+	m.DecoderJWTModel.SetValue(nested.Token)
+	m.DecoderSecretModel.SetValue("")
+	m.DecoderPassphraseModel.SetValue("")
+	m.SelectedNested = 0
+
+	cmds := m.decode()
+	m.layout()
+
+	return tea.Batch(cmds...)
+}
+
+// openNextNestedToken opens the token after the open one among those nested
+// in the same token, going back up to it first, or the selected one when no
+// nested token is open.
+func (m *BubbleTeaModel) openNextNestedToken() tea.Cmd {
+	var cmds []tea.Cmd
+	if len(m.DecoderStack) > 0 {
+		cmds = append(cmds, m.closeNestedToken())
+		if len(m.NestedTokens) > 0 {
+			m.SelectedNested = (m.SelectedNested + 1) % len(m.NestedTokens)
+		}
+	}
+
+	if len(m.NestedTokens) > 0 {
+		cmds = append(cmds, m.openNestedToken())
+	}
+
+	return tea.Batch(cmds...)
+}
+
+// closeNestedToken goes back to the token the current one was opened from.
+func (m *BubbleTeaModel) closeNestedToken() tea.Cmd {
+	level := m.DecoderStack[len(m.DecoderStack)-1]
+	m.DecoderStack = m.DecoderStack[:len(m.DecoderStack)-1]
+
+	m.DecoderJWTModel.SetValue(level.Token)
+	m.DecoderSecretModel.SetValue(level.Secret)
+	m.DecoderPassphraseModel.SetValue(level.Passphrase)
+
+	cmds := m.decode()
+	m.SelectedNested = max(slices.IndexFunc(m.NestedTokens, func(t NestedToken) bool { return t.Path == level.Path }), 0)
+	m.renderNestedTokens()
+	m.layout()
+
+	return tea.Batch(cmds...)
+}
+
+// renderNestedTokens shows the path to the current token and the tokens
+// nested in it, marking the selected one.
+func (m *BubbleTeaModel) renderNestedTokens() {
+	var lines []string
+
+	if len(m.DecoderStack) > 0 {
+		path := []string{"token"}
+		for _, level := range m.DecoderStack {
+			path = append(path, level.Path)
+		}
+		lines = append(lines, strings.Join(path, " › "), "")
+	}
+
+	for i, nested := range m.NestedTokens {
+		marker := "  "
+		if i == m.SelectedNested {
+			marker = "▸ "
+		}
+		lines = append(lines, marker+nested.Path)
+	}
+
+	if len(m.NestedTokens) == 0 {
+		lines = append(lines, StatusNoNestedTokens)
+	}
+
+	m.DecoderNestedModel.SetValue(strings.Join(lines, "\n"))
+}
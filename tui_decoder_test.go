@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNextNestedTokenKeyOpensToken(t *testing.T) {
+	alice := signTestToken(t, jwt.MapClaims{"sub": "alice"}, "secret")
+	bob := signTestToken(t, jwt.MapClaims{"sub": "bob"}, "secret")
+	outer := signTestToken(t, jwt.MapClaims{"sub": "service", "chain": []any{alice, bob}}, "secret")
+
+	// The token is decoded with the first message the panels see.
+	var m tea.Model = NewBubbleTeamModel(BubbleTeaModelOptions{Token: outer})
+	m, _ = m.Update(tea.FocusMsg{})
+	if nested := m.(BubbleTeaModel).NestedTokens; len(nested) != 2 {
+		t.Fatalf("nested tokens = %+v, want 2", nested)
+	}
+
+	next := tea.KeyPressMsg{Code: []rune(KeyNextNestedToken[len("ctrl+"):])[0], Mod: tea.ModCtrl}
+	if next.String() != KeyNextNestedToken {
+		t.Fatalf("key %q, want %q", next.String(), KeyNextNestedToken)
+	}
+
+	for _, want := range []struct {
+		path  string
+		token string
+	}{
+		{"claims.chain[0]", alice},
+		{"claims.chain[1]", bob},
+		{"claims.chain[0]", alice},
+	} {
+		m, _ = m.Update(next)
+		decoder := m.(BubbleTeaModel)
+
+		if len(decoder.DecoderStack) != 1 || decoder.DecoderStack[0].Path != want.path {
+			t.Fatalf("decoder stack = %+v, want %s open", decoder.DecoderStack, want.path)
+		}
+		if got := decoder.DecoderJWTModel.GetValue(); got != want.token {
+			t.Errorf("%s: decoder token = %q, want %q", want.path, got, want.token)
+		}
+		if decoder.DecoderStack[0].Token != outer {
+			t.Errorf("%s: outer token not kept to go back to", want.path)
+		}
+	}
+}
+
+func TestDecoderPassphraseDecryptsJWE(t *testing.T) {
+	encrypted, err := os.ReadFile("testdata/pkcs8/aes256.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var m tea.Model = NewBubbleTeamModel(BubbleTeaModelOptions{
+		Token:      encryptToPKCS8Fixture(t),
+		Secret:     string(encrypted),
+		Passphrase: testPassphrase,
+	})
+	m, _ = m.Update(tea.FocusMsg{})
+	decoder := m.(BubbleTeaModel)
+
+	if !decoder.ShowDecoderPassphrase() {
+		t.Error("passphrase input hidden for an encrypted key")
+	}
+	if !decoder.DecodeResult.IsDecrypted() {
+		t.Errorf("not decrypted with the passphrase: %v (key error %v)", decoder.DecodeResult.Issues, decoder.DecodeResult.KeyError)
+	}
+
+	focus := tea.KeyPressMsg{Code: []rune(KeyFocusPassphrase[len("ctrl+"):])[0], Mod: tea.ModCtrl}
+	m, _ = m.Update(focus)
+	if got := m.(BubbleTeaModel).FocusedElement; got != ElementDecoderPassphraseInput {
+		t.Errorf("focused %s, want %s", got, ElementDecoderPassphraseInput)
+	}
+}
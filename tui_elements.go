@@ -1,26 +1,40 @@
 package main
 
 import (
+	"strings"
+
 	"charm.land/bubbles/v2/textarea"
+	"charm.land/bubbles/v2/textinput"
 	"charm.land/bubbles/v2/viewport"
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
 	zone "github.com/lrstanley/bubblezone/v2"
 )
 
+// CompactPanelHeight is the height of a panel holding a single line input
+const CompactPanelHeight = 5
+
+// MinPanelHeight is the least height a panel is given, room for one line.
+// On terminals too short for a whole column its bottom is cut off instead.
+const MinPanelHeight = CompactPanelHeight
+
 // PanelModel is a reusable TUI panel component that can display either
 // an editable textarea or a read-only viewport, with optional error status
 type PanelModel struct {
 	TextArea    textarea.Model
+	Input       textinput.Model
 	Viewport    viewport.Model
 	Title       string
 	Placeholder string
 	Focused     bool
 	ElementID   Element
 	EditingMode bool
+	Compact     bool
+	Masked      bool
 	Height      int
 	Width       int
 	Error       string
+	Status      string
 	Content     string
 }
 
@@ -45,10 +59,32 @@ func NewPanelModel(ID Element, title, placeholder string, editingMode bool) Pane
 		Height:      0,
 		Width:       0,
 		Error:       "",
+		Status:      "",
 		Content:     "",
 	}
 }
 
+// NewCompactPanelModel creates an editable panel for short single line
+// inputs such as passphrases
+func NewCompactPanelModel(ID Element, title, placeholder string) PanelModel {
+	m := NewPanelModel(ID, title, placeholder, true)
+	m.Compact = true
+	m.TextArea.KeyMap.InsertNewline.SetEnabled(false)
+	return m
+}
+
+// NewMaskedPanelModel creates a compact panel whose input is masked, edited
+// through a text input as the textarea cannot hide what is typed
+func NewMaskedPanelModel(ID Element, title, placeholder string) PanelModel {
+	m := NewCompactPanelModel(ID, title, placeholder)
+	m.Masked = true
+	m.Input = textinput.New()
+	m.Input.Placeholder = placeholder
+	m.Input.Prompt = ""
+	m.Input.EchoMode = textinput.EchoPassword
+	return m
+}
+
 func (m PanelModel) Init() tea.Cmd {
 	return nil
 }
@@ -60,19 +96,20 @@ func (m PanelModel) Update(msg tea.Msg) (PanelModel, tea.Cmd) {
 	case FocusElementMsg:
 		if msg.Element == m.ElementID {
 			m.Focused = true
-			if m.EditingMode {
+			if m.Masked {
+				m.Input.Focus()
+			} else if m.EditingMode {
 				m.TextArea.Focus()
 			}
 		} else {
-			m.Focused = false
-			if m.EditingMode {
-				m.TextArea.Blur()
-			}
+			m.Blur()
 		}
 		return m, nil
 	}
 
-	if m.EditingMode {
+	if m.Masked {
+		m.Input, cmd = m.Input.Update(msg)
+	} else if m.EditingMode {
 		m.TextArea, cmd = m.TextArea.Update(msg)
 	} else {
 		m.Viewport, cmd = m.Viewport.Update(msg)
@@ -90,7 +127,9 @@ func (m PanelModel) View() string {
 	}
 
 	var content string
-	if m.EditingMode {
+	if m.Masked {
+		content = m.Input.View()
+	} else if m.EditingMode {
 		content = m.TextArea.View()
 	} else {
 		content = m.Viewport.View()
@@ -101,6 +140,15 @@ func (m PanelModel) View() string {
 	statusBar := styleStatus.Width(width).Render("")
 	if m.Error != "" {
 		statusBar = styleStatusError.Width(width).Render(m.Error)
+	} else if m.Status != "" {
+		statusBar = styleStatusSuccess.Width(width).Render(m.Status)
+	}
+
+	// A status that wraps takes its extra lines from the content so the panel
+	// keeps the height it was given.
+	if extra := lipgloss.Height(statusBar) - 1; extra > 0 {
+		lines := strings.Split(content, "\n")
+		content = strings.Join(lines[:max(1, len(lines)-extra)], "\n")
 	}
 
 	return zone.Mark(
@@ -115,6 +163,29 @@ func (m PanelModel) View() string {
 	)
 }
 
+// SizePanelColumn sizes a vertical stack of panels. Compact panels keep
+// their single line and the remaining height is split between the others,
+// which get at least MinPanelHeight.
+func SizePanelColumn(height, width int, panels ...*PanelModel) {
+	flexible := 0
+	for _, panel := range panels {
+		if panel.Compact {
+			height -= CompactPanelHeight + 1
+		} else {
+			flexible++
+		}
+	}
+
+	for _, panel := range panels {
+		if panel.Compact {
+			panel.SetHeight(CompactPanelHeight)
+		} else {
+			panel.SetHeight(max(height/flexible, MinPanelHeight))
+		}
+		panel.SetWidth(width)
+	}
+}
+
 func (m *PanelModel) SetHeight(height int) {
 	m.Height = height
 	// Account for title, borders, and status bar (typically 3-4 lines total)
@@ -132,7 +203,9 @@ func (m *PanelModel) SetHeight(height int) {
 func (m *PanelModel) SetWidth(width int) {
 	m.Width = width - 2
 	// Account for borders (typically 2 columns total)
-	if m.EditingMode {
+	if m.Masked {
+		m.Input.SetWidth(width - 2)
+	} else if m.EditingMode {
 		m.TextArea.SetWidth(width - 2)
 	} else {
 		m.Viewport.SetWidth(width - 2)
@@ -141,7 +214,9 @@ func (m *PanelModel) SetWidth(width int) {
 
 func (m *PanelModel) SetValue(content string) {
 	m.Content = content
-	if m.EditingMode {
+	if m.Masked {
+		m.Input.SetValue(content)
+	} else if m.EditingMode {
 		m.TextArea.SetValue(content)
 	} else {
 		m.Viewport.SetContent(content)
@@ -149,6 +224,9 @@ func (m *PanelModel) SetValue(content string) {
 }
 
 func (m PanelModel) GetValue() string {
+	if m.Masked {
+		return m.Input.Value()
+	}
 	if m.EditingMode {
 		return m.TextArea.Value()
 	}
@@ -159,9 +237,16 @@ func (m *PanelModel) SetError(error string) {
 	m.Error = error
 }
 
+// SetStatus sets a success message, shown when the panel has no error
+func (m *PanelModel) SetStatus(status string) {
+	m.Status = status
+}
+
 func (m *PanelModel) Blur() {
 	m.Focused = false
-	if m.EditingMode {
+	if m.Masked {
+		m.Input.Blur()
+	} else if m.EditingMode {
 		m.TextArea.Blur()
 	}
 }
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestSizePanelColumn(t *testing.T) {
+	tests := []struct {
+		name   string
+		height int
+		want   []int
+	}{
+		{"tall terminal", 60, []int{24, 24, CompactPanelHeight, CompactPanelHeight}},
+		{"short terminal", 14, []int{MinPanelHeight, MinPanelHeight, CompactPanelHeight, CompactPanelHeight}},
+		{"no room at all", -10, []int{MinPanelHeight, MinPanelHeight, CompactPanelHeight, CompactPanelHeight}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := NewPanelModel(ElementDecoderJWTTextArea, TitleJWTToken, "", true)
+			secret := NewPanelModel(ElementDecoderSecretTextArea, TitleSecret, "", true)
+			issuer := NewCompactPanelModel(ElementDecoderIssuerInput, TitleIssuer, "")
+			leeway := NewCompactPanelModel(ElementDecoderLeewayInput, TitleLeeway, "")
+
+			SizePanelColumn(tt.height, 80, &token, &secret, &issuer, &leeway)
+
+			for i, panel := range []PanelModel{token, secret, issuer, leeway} {
+				if panel.Height != tt.want[i] {
+					t.Errorf("%s height = %d, want %d", panel.Title, panel.Height, tt.want[i])
+				}
+			}
+		})
+	}
+}
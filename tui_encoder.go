@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// encode builds the token from the encoder panels, wrapping it as a JWE when
+// a recipient key is entered, and updates the panels with the result.
+func (m *BubbleTeaModel) encode() {
+	var headerStr, payloadStr string
+
+	headerStr = m.EncoderJWTHeaderModel.GetValue()
+	payloadStr = m.EncoderJWTPayloadModel.GetValue()
+
+	secretStr := m.EncoderSecretModel.GetValue()
+	passphraseStr := m.EncoderPassphraseModel.GetValue()
+	recipientStr := m.EncoderRecipientModel.GetValue()
+
+	var headerError, payloadError string
+
+	var header map[string]interface{}
+	var claims jwt.MapClaims
+
+	if headerStr != "" {
+		if err := json.Unmarshal([]byte(headerStr), &header); err != nil {
+			headerError = "Invalid header JSON: " + err.Error()
+		}
+	}
+
+	if payloadStr != "" {
+		if err := json.Unmarshal([]byte(payloadStr), &claims); err != nil {
+			payloadError = "Invalid payload JSON: " + err.Error()
+		}
+	}
+
+	// A token that does not match the schema is not signed.
+	if m.Schema != nil && headerStr != "" && headerError == "" && payloadStr != "" && payloadError == "" {
+		payloadError = FormatSchemaViolations(m.Schema.Validate(header, claims))
+	}
+
+	m.EncoderJWTHeaderModel.SetError(headerError)
+	m.EncoderJWTPayloadModel.SetError(payloadError)
+	m.EncoderRecipientModel.Title = m.encryptionTitle()
+
+	if (headerStr != "" && headerError == "") && (payloadStr != "" && payloadError == "") {
+		if recipientStr != "" {
+			m.EncodeResult = JWTEncryptToken(header, claims, secretStr, passphraseStr, JWEEncryptOptions{
+				KeyAlgorithm:      m.EncoderKeyAlgorithm,
+				ContentEncryption: m.EncoderContentEncryption,
+				RecipientKey:      recipientStr,
+				Nested:            m.EncoderNested,
+			})
+		} else {
+			m.EncodeResult = JWTEncodeToken(header, claims, secretStr, passphraseStr)
+		}
+		m.EncoderJWTModel.SetValue(m.EncodeResult.Token)
+		m.EncoderJWTHeaderModel.SetError(m.EncodeResult.HeaderError)
+		m.EncoderSecretModel.SetError(m.EncodeResult.SigningError)
+		m.EncoderRecipientModel.SetError(m.EncodeResult.EncryptionError)
+	} else {
+		m.EncoderJWTModel.SetValue("")
+		m.EncoderSecretModel.SetError("")
+		m.EncoderRecipientModel.SetError("")
+		m.EncodeResult = &JWTEncodeResult{
+			Token:        "",
+			HeaderError:  headerError,
+			PayloadError: payloadError,
+			SigningError: "",
+		}
+	}
+}
+
+// encryptionTitle shows the selected JWE algorithms in the recipient panel.
+func (m BubbleTeaModel) encryptionTitle() string {
+	mode := EncryptionModeClaims
+	if m.EncoderNested {
+		mode = EncryptionModeNested
+	}
+	return fmt.Sprintf("%s %s, %s, %s", TitleRecipient, m.EncoderKeyAlgorithm, m.EncoderContentEncryption, mode)
+}
+
+// nextKeyAlgorithm returns the key management algorithm after alg.
+func nextKeyAlgorithm(alg jose.KeyAlgorithm) jose.KeyAlgorithm {
+	i := slices.Index(jweKeyAlgorithms, alg)
+	return jweKeyAlgorithms[(i+1)%len(jweKeyAlgorithms)]
+}
+
+// nextContentEncryption returns the content encryption algorithm after enc.
+func nextContentEncryption(enc jose.ContentEncryption) jose.ContentEncryption {
+	i := slices.Index(jweContentEncryptions, enc)
+	return jweContentEncryptions[(i+1)%len(jweContentEncryptions)]
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+// fixtureInputs are what the attack fixtures are derived from.
+type fixtureInputs struct {
+	Token       string
+	PublicKey   string
+	AttackerKey *rsa.PrivateKey
+}
+
+// generateFixtures derives the attack fixtures from the token and public key
+// entered in the encoder's fixtures mode, once the attacker key is generated.
+// They are kept until one of the inputs changes.
+func (m *BubbleTeaModel) generateFixtures() {
+	inputs := fixtureInputs{
+		Token:       m.EncoderFixtureTokenModel.GetValue(),
+		PublicKey:   m.EncoderFixtureKeyModel.GetValue(),
+		AttackerKey: m.AttackerKey,
+	}
+	if inputs == m.FixturesFrom {
+		return
+	}
+	m.FixturesFrom = inputs
+
+	m.Fixtures = nil
+	m.EncoderFixturesModel.SetValue("")
+	m.EncoderFixturesModel.SetStatus("")
+	m.EncoderFixturesModel.SetError("")
+	m.EncoderFixtureTokenModel.SetError("")
+	m.EncoderFixtureKeyModel.SetError("")
+
+	if inputs.Token == "" {
+		return
+	}
+
+	if inputs.AttackerKey == nil {
+		if m.AttackerKeyErr != nil {
+			m.EncoderFixturesModel.SetError(m.AttackerKeyErr.Error())
+		} else {
+			m.EncoderFixturesModel.SetStatus(StatusGeneratingAttackerKey)
+		}
+		return
+	}
+
+	fixtures, err := GenerateAttackFixtures(inputs.Token, inputs.PublicKey, inputs.AttackerKey)
+	if err != nil {
+		if errors.Is(err, ErrInvalidPublicKey) {
+			m.EncoderFixtureKeyModel.SetError(err.Error())
+		} else {
+			m.EncoderFixtureTokenModel.SetError(err.Error())
+		}
+		return
+	}
+
+	m.Fixtures = fixtures
+
+	entries := make([]string, 0, len(fixtures))
+	for _, f := range fixtures {
+		entries = append(entries, fmt.Sprintf("%s: %s\n%s", f.Label, f.Description, f.Token))
+	}
+	m.EncoderFixturesModel.SetValue(strings.Join(entries, "\n\n"))
+	m.EncoderFixturesModel.SetStatus(fmt.Sprintf(StatusFixtures, len(fixtures)))
+}
+
+// toggleFixtures switches the encoder between signing tokens and deriving
+// attack fixtures, starting from the token just signed. The attacker key is
+// generated the first time.
+func (m *BubbleTeaModel) toggleFixtures() tea.Cmd {
+	m.EncoderFixtures = !m.EncoderFixtures
+	if !m.EncoderFixtures {
+		m.FocusedElement = ElementEncoderHeaderTextArea
+		return nil
+	}
+
+	m.FocusedElement = ElementEncoderFixtureTokenTextArea
+	if m.EncoderFixtureTokenModel.GetValue() == "" {
+		m.EncoderFixtureTokenModel.SetValue(m.EncoderJWTModel.GetValue())
+	}
+	m.generateFixtures()
+
+	if m.AttackerKey != nil || m.GeneratingAttackerKey {
+		return nil
+	}
+	m.GeneratingAttackerKey = true
+	m.AttackerKeyErr = nil
+	return GenerateAttackerKeyCmd()
+}
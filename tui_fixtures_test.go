@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+func TestToggleFixturesGeneratesAttackerKeyOnce(t *testing.T) {
+	m := NewBubbleTeamModel(BubbleTeaModelOptions{})
+	m.SelectedView = ViewJWTEncoder
+	m.EncoderFixtureTokenModel.SetValue(signTestTokenWithKey(t, testKey(t, KeyKindECP256), ""))
+
+	update := func(msg tea.Msg) tea.Cmd {
+		t.Helper()
+		model, cmd := m.Update(msg)
+		m = model.(BubbleTeaModel)
+		return cmd
+	}
+
+	if cmd := m.toggleFixtures(); cmd == nil || !m.GeneratingAttackerKey {
+		t.Fatal("entering fixtures mode did not start generating the attacker key")
+	}
+	if m.Fixtures != nil || m.EncoderFixturesModel.Status != StatusGeneratingAttackerKey {
+		t.Errorf("fixtures %d, status %q before the attacker key is generated", len(m.Fixtures), m.EncoderFixturesModel.Status)
+	}
+
+	update(AttackerKeyMsg{Key: testAttackerKey(t)})
+	if m.GeneratingAttackerKey || len(m.Fixtures) == 0 {
+		t.Fatalf("generating %v, %d fixtures after the attacker key arrived", m.GeneratingAttackerKey, len(m.Fixtures))
+	}
+
+	// Other messages keep the fixtures rather than deriving them again.
+	first := &m.Fixtures[0]
+	update(tea.FocusMsg{})
+	if &m.Fixtures[0] != first {
+		t.Error("fixtures derived again without a change to their inputs")
+	}
+
+	m.toggleFixtures()
+	if cmd := m.toggleFixtures(); cmd != nil {
+		t.Error("entering fixtures mode again generated another attacker key")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+// CrackJob is a wordlist being tried against the inspector's token.
+type CrackJob struct {
+	Token   string
+	Counter *CrackCounter
+	// Size is the size of the wordlist in bytes, used to show progress.
+	Size   int64
+	cancel context.CancelFunc
+}
+
+// inspect audits the token in the inspector and lists the findings.
+func (m *BubbleTeaModel) inspect() {
+	token := m.InspectorJWTModel.GetValue()
+	secret := m.InspectorSecretModel.GetValue()
+
+	m.Findings = nil
+	m.InspectorFindingsModel.SetValue("")
+	m.InspectorFindingsModel.SetError("")
+	m.InspectorFindingsModel.SetStatus("")
+	m.InspectorJWTModel.SetError("")
+
+	if token == "" {
+		return
+	}
+
+	result := JWTDecodeToken(token, JWTDecodeOptions{Secret: secret})
+	if result.Token == nil {
+		m.InspectorJWTModel.SetError(StatusInvalidToken)
+		return
+	}
+
+	m.Findings = InspectToken(result, secret, time.Now())
+	if m.CrackedToken != "" && m.CrackedToken == strings.TrimSpace(token) {
+		guessable := Finding{Severity: SeverityHigh, Check: "guessable_secret", Message: fmt.Sprintf("secret %q is in the wordlist", m.CrackedSecret)}
+		m.Findings = append([]Finding{guessable}, m.Findings...)
+	}
+	if len(m.Findings) == 0 {
+		m.InspectorFindingsModel.SetStatus(StatusNoFindings)
+		return
+	}
+
+	counts := map[Severity]int{}
+	for _, f := range m.Findings {
+		counts[f.Severity]++
+	}
+
+	m.InspectorFindingsModel.SetValue(FormatFindings(m.Findings))
+	m.InspectorFindingsModel.SetError(fmt.Sprintf(StatusFindings, counts[SeverityHigh], counts[SeverityMedium], counts[SeverityLow]))
+}
+
+// enterInspector starts the inspector on the decoder's token when it has
+// none of its own yet.
+func (m *BubbleTeaModel) enterInspector() {
+	if m.InspectorJWTModel.GetValue() == "" {
+		m.InspectorJWTModel.SetValue(m.DecoderJWTModel.GetValue())
+		m.InspectorSecretModel.SetValue(m.DecoderSecretModel.GetValue())
+	}
+	m.inspect()
+}
+
+// startCrack tries the wordlist against the inspector's token in the
+// background, or cancels the run in progress.
+func (m *BubbleTeaModel) startCrack() tea.Cmd {
+	if m.Crack != nil {
+		m.Crack.cancel()
+		return nil
+	}
+
+	path := strings.TrimSpace(m.InspectorWordlistModel.GetValue())
+	if path == "" {
+		return nil
+	}
+
+	wordlist, err := os.Open(path)
+	if err != nil {
+		m.InspectorWordlistModel.SetError(err.Error())
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &CrackJob{
+		Token:   strings.TrimSpace(m.InspectorJWTModel.GetValue()),
+		Counter: &CrackCounter{},
+		cancel:  cancel,
+	}
+	if info, err := wordlist.Stat(); err == nil {
+		job.Size = info.Size()
+	}
+
+	m.Crack = job
+	m.InspectorWordlistModel.SetError("")
+	m.renderCrackProgress()
+
+	return func() tea.Msg {
+		defer wordlist.Close()
+		defer cancel()
+
+		result, err := CrackHMACSecret(ctx, job.Token, wordlist, runtime.NumCPU(), job.Counter)
+		return CrackDoneMsg{Job: job, Result: result, Err: err}
+	}
+}
+
+// renderCrackProgress shows how far the running crack has come.
+func (m *BubbleTeaModel) renderCrackProgress() {
+	if m.Crack != nil {
+		m.InspectorWordlistModel.SetStatus(FormatCrackProgress(m.Crack.Counter, m.Crack.Size))
+	}
+}
+
+// finishCrack reports the outcome of a crack, adding a finding for a
+// secret that was found.
+func (m *BubbleTeaModel) finishCrack(msg CrackDoneMsg) {
+	if msg.Job != m.Crack {
+		return
+	}
+	m.Crack = nil
+
+	switch {
+	case msg.Result.Found:
+		m.CrackedToken, m.CrackedSecret = msg.Job.Token, msg.Result.Secret
+		m.InspectorWordlistModel.SetError(fmt.Sprintf(StatusCrackFound, msg.Result.Secret))
+	case errors.Is(msg.Err, context.Canceled):
+		m.InspectorWordlistModel.SetStatus(fmt.Sprintf(StatusCrackCancelled, msg.Result.Tried))
+	case msg.Err != nil:
+		m.InspectorWordlistModel.SetError(msg.Err.Error())
+	default:
+		m.InspectorWordlistModel.SetStatus(fmt.Sprintf(StatusCrackNotFound, msg.Result.Tried))
+	}
+}
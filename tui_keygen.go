@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "charm.land/bubbletea/v2"
+)
+
+// generateKey starts generating a key of the selected kind in the
+// background.
+func (m *BubbleTeaModel) generateKey() tea.Cmd {
+	length := DefaultHMACLength
+	if value := strings.TrimSpace(m.KeygenLengthModel.GetValue()); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			m.KeygenLengthModel.SetError(fmt.Sprintf("invalid length %q", value))
+			return nil
+		}
+		length = n
+	}
+	m.KeygenLengthModel.SetError("")
+
+	m.KeygenSeq++
+	m.KeygenPrivateModel.Title = m.keygenTitle()
+	m.KeygenPrivateModel.SetError("")
+	m.KeygenPrivateModel.SetStatus(fmt.Sprintf(StatusGeneratingKey, m.KeygenKind))
+
+	return GenerateKeyCmd(m.KeygenSeq, m.KeygenKind, length)
+}
+
+// finishKeyGeneration shows a generated key unless a newer one was asked
+// for in the meantime.
+func (m *BubbleTeaModel) finishKeyGeneration(msg KeyGeneratedMsg) {
+	if msg.Seq != m.KeygenSeq {
+		return
+	}
+
+	if msg.Err != nil {
+		m.KeygenPrivateModel.SetError(msg.Err.Error())
+		return
+	}
+
+	m.GeneratedKey = msg.Key
+	if m.KeygenAlgorithm != "" {
+		// A shorter HMAC secret may no longer allow the chosen algorithm.
+		if key, err := msg.Key.WithAlgorithm(m.KeygenAlgorithm); err == nil {
+			m.GeneratedKey = key
+		}
+	}
+	m.renderKey()
+}
+
+// cycleKeyAlgorithm sets the next algorithm the generated key can sign with
+// in its JWKs.
+func (m *BubbleTeaModel) cycleKeyAlgorithm() {
+	if m.GeneratedKey == nil {
+		return
+	}
+
+	algs := KeyAlgorithms(m.GeneratedKey.Kind, len(m.GeneratedKey.Secret))
+	alg := algs[(slices.Index(algs, m.GeneratedKey.Algorithm)+1)%len(algs)]
+
+	key, err := m.GeneratedKey.WithAlgorithm(alg)
+	if err != nil {
+		m.KeygenPrivateModel.SetError(err.Error())
+		return
+	}
+
+	m.GeneratedKey = key
+	m.KeygenAlgorithm = alg
+	m.renderKey()
+}
+
+// renderKey shows the generated key in the selected format.
+func (m *BubbleTeaModel) renderKey() {
+	m.KeygenPrivateModel.Title = m.keygenTitle()
+	if m.GeneratedKey == nil {
+		return
+	}
+
+	m.KeygenPrivateModel.SetValue(m.GeneratedKey.PrivateKey(m.KeygenFormat))
+	m.KeygenPrivateModel.SetStatus(fmt.Sprintf(StatusKeyID, m.GeneratedKey.Algorithm, m.GeneratedKey.KeyID))
+	m.KeygenPublicModel.SetValue(m.GeneratedKey.VerificationKey(m.KeygenFormat))
+	m.KeygenPublicModel.SetStatus("")
+	if m.GeneratedKey.Kind == KeyKindHMAC {
+		m.KeygenPublicModel.SetStatus(StatusHMACPublicKey)
+	}
+}
+
+// useKeys sets the generated key as the encoder's signing key and the
+// decoder's verification key. The encoder only signs with PEM keys.
+func (m *BubbleTeaModel) useKeys() {
+	if m.GeneratedKey == nil {
+		return
+	}
+
+	m.EncoderSecretModel.SetValue(m.GeneratedKey.SigningKey())
+	m.DecoderSecretModel.SetValue(m.GeneratedKey.VerificationKey(m.KeygenFormat))
+	m.KeygenPublicModel.SetStatus(StatusKeysUsed)
+
+	// The encoder's passphrase input depends on its secret.
+	m.layout()
+}
+
+// keygenTitle shows the selected key kind and format in the private key
+// panel.
+func (m BubbleTeaModel) keygenTitle() string {
+	return fmt.Sprintf("%s %s, %s", TitlePrivateKey, m.KeygenKind, m.KeygenFormat)
+}
+
+// nextKeyFormat returns the output format after format.
+func nextKeyFormat(format string) string {
+	if format == KeyFormatPEM {
+		return KeyFormatJWK
+	}
+	return KeyFormatPEM
+}